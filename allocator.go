@@ -0,0 +1,318 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultAllocatorRetries = 10
+
+type AllocatorStrategy string
+
+const (
+	// StrategyPool keeps the free ids in a list in one document, see InitializePool.
+	StrategyPool AllocatorStrategy = "pool"
+	// StrategyInsert stores a document per allocated id and picks free ids at random, see InitializeInsertPool.
+	StrategyInsert AllocatorStrategy = "insert"
+	// StrategyChunk hands out single ids from chunks of ChunkSize ids it takes from a chunk pool and holds in
+	// memory, see NewLocalAllocator and InitializeChunkPool.
+	StrategyChunk AllocatorStrategy = "chunk"
+	// StrategyCounter hands out the increasing ids of GetUniqueIdentity and never reuses them.
+	StrategyCounter AllocatorStrategy = "counter"
+	// StrategyLocal is another name of StrategyChunk.
+	StrategyLocal AllocatorStrategy = "local"
+)
+
+/* AllocatorConfig selects and configures the allocation strategy of an Allocator, typically from the configuration
+ * file of an NF. */
+type AllocatorConfig struct {
+	Strategy AllocatorStrategy `json:"strategy" yaml:"strategy"`
+	// Name is the name of the pool, and of the collection holding its state except for the counter strategy.
+	Name string `json:"name" yaml:"name"`
+	// Min and Max bound the ids, Min included and Max excluded.
+	Min int32 `json:"min" yaml:"min"`
+	Max int32 `json:"max" yaml:"max"`
+	// Retries is the number of random picks the insert and chunk strategies try before they scan the pool in order,
+	// default 10.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// ChunkSize is the number of ids per chunk, chunk strategy only.
+	ChunkSize int32 `json:"chunkSize,omitempty" yaml:"chunkSize,omitempty"`
+	// PrefetchThreshold is the share of the held ids in use from which the next chunk is fetched, chunk strategy
+	// only, default 0.8.
+	PrefetchThreshold float64 `json:"prefetchThreshold,omitempty" yaml:"prefetchThreshold,omitempty"`
+}
+
+/* AllocatorStats describes the occupancy of an allocator in ids. For the chunk strategy the ids of the chunks held by
+ * other instances count as allocated. */
+type AllocatorStats struct {
+	Strategy  AllocatorStrategy
+	Capacity  int64
+	Allocated int64
+	// Free is the number of ids that can still be allocated, which for the counter strategy excludes released ids.
+	Free int64
+}
+
+/* Allocator hands out unique ids from a pool shared by all instances using the same configuration. */
+type Allocator interface {
+	// Allocate returns a free id and marks it allocated, failing with ErrPoolExhausted when none is left.
+	Allocate(ctx context.Context) (int32, error)
+	// Release makes id free again. Releasing a free id has no effect, an id outside the pool fails with ErrOutOfRange.
+	Release(ctx context.Context, id int32) error
+	// Reserve marks the given id allocated, failing with ErrAlreadyAllocated when it is.
+	Reserve(ctx context.Context, id int32) error
+	Stats(ctx context.Context) (AllocatorStats, error)
+}
+
+/* Return the ids of the chunk with the given number, lower included and upper excluded. */
+func (cfg AllocatorConfig) ChunkRange(chunk int32) (lower int32, upper int32) {
+	lower = cfg.Min + chunk*cfg.ChunkSize
+	return lower, lower + cfg.ChunkSize
+}
+
+/* Return an Allocator using the strategy chosen by cfg, initializing the pool if needed. A pool that is already
+ * defined with another strategy or range fails with ErrPoolConflict. Strategies that do not support Release or
+ * Reserve fail them with ErrUnsupported. */
+func (db *DB) NewAllocator(ctx context.Context, cfg AllocatorConfig) (Allocator, error) {
+	const op = "NewAllocator"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	if cfg.Name == "" || cfg.Min >= cfg.Max {
+		return nil, newError(op, ErrInvalidPool, nil)
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultAllocatorRetries
+	}
+	base := allocator{db: db, cfg: cfg}
+
+	switch cfg.Strategy {
+	case StrategyPool:
+		if err := db.InitializePoolWithContext(ctx, cfg.Name, cfg.Min, cfg.Max); err != nil {
+			return nil, err
+		}
+		return &listAllocator{base}, nil
+	case StrategyInsert:
+		err := db.InitializeInsertPoolWithContext(ctx, cfg.Name, int(cfg.Min), int(cfg.Max), cfg.Retries)
+		if err != nil {
+			return nil, err
+		}
+		return &insertAllocator{base}, nil
+	case StrategyChunk, StrategyLocal:
+		err := db.InitializeChunkPoolWithContext(ctx, cfg.Name, int(cfg.Min), int(cfg.Max), cfg.Retries,
+			int(cfg.ChunkSize))
+		if err != nil {
+			return nil, err
+		}
+		return db.NewLocalAllocator(ctx, cfg.Name, cfg.PrefetchThreshold)
+	case StrategyCounter:
+		pool := poolMetadata{Name: cfg.Name, Strategy: StrategyCounter, Min: int(cfg.Min), Max: int(cfg.Max)}
+		if err := db.registerPool(ctx, op, pool); err != nil {
+			return nil, err
+		}
+		a := &counterAllocator{base}
+		if err := a.raise(ctx); err != nil {
+			return nil, wrapError(op, err)
+		}
+		return a, nil
+	}
+	return nil, newError(op, ErrInvalidPool, fmt.Errorf("unknown allocation strategy %q", cfg.Strategy))
+}
+
+type allocator struct {
+	db  *DB
+	cfg AllocatorConfig
+}
+
+/* Check that id lies in a chunk for the chunk strategy and in [Min, Max) otherwise. */
+func (a *allocator) checkRange(op string, id int32) error {
+	lower, upper := a.cfg.Min, a.cfg.Max
+	if a.chunked() {
+		upper = a.cfg.Min + a.chunks()*a.cfg.ChunkSize
+	}
+	if id < lower || id >= upper {
+		return newError(op, ErrOutOfRange, fmt.Errorf("%d is outside [%d, %d)", id, lower, upper))
+	}
+	return nil
+}
+
+func (a *allocator) capacity() int64 {
+	if a.chunked() {
+		return int64(a.chunks()) * int64(a.cfg.ChunkSize)
+	}
+	return int64(a.cfg.Max) - int64(a.cfg.Min)
+}
+
+func (a *allocator) chunked() bool {
+	return a.cfg.Strategy == StrategyChunk || a.cfg.Strategy == StrategyLocal
+}
+
+func (a *allocator) chunks() int32 {
+	return (a.cfg.Max - a.cfg.Min) / a.cfg.ChunkSize
+}
+
+/* Return the number of the chunk holding id. */
+func (a *allocator) chunkOf(id int32) int32 {
+	return (id - a.cfg.Min) / a.cfg.ChunkSize
+}
+
+func (a *allocator) stats(allocated int64) AllocatorStats {
+	return AllocatorStats{
+		Strategy:  a.cfg.Strategy,
+		Capacity:  a.capacity(),
+		Allocated: allocated,
+		Free:      a.capacity() - allocated,
+	}
+}
+
+type listAllocator struct {
+	allocator
+}
+
+func (a *listAllocator) Allocate(ctx context.Context) (int32, error) {
+	return a.db.GetIDFromPoolWithContext(ctx, a.cfg.Name)
+}
+
+func (a *listAllocator) Release(ctx context.Context, id int32) error {
+	if err := a.checkRange("Allocator.Release", id); err != nil {
+		return err
+	}
+	return a.db.ReleaseIDToPoolWithContext(ctx, a.cfg.Name, id)
+}
+
+func (a *listAllocator) Reserve(ctx context.Context, id int32) error {
+	const op = "Allocator.Reserve"
+	if err := a.checkRange(op, id); err != nil {
+		return err
+	}
+	result, err := a.db.collection(a.cfg.Name).UpdateOne(ctx, bson.M{"_id": a.cfg.Name, "ids": id},
+		bson.M{"$pull": bson.M{"ids": id}})
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if result.MatchedCount == 0 {
+		return newError(op, ErrAlreadyAllocated, nil)
+	}
+	return nil
+}
+
+func (a *listAllocator) Stats(ctx context.Context) (AllocatorStats, error) {
+	const op = "Allocator.Stats"
+	var doc struct {
+		IDs []int32 `bson:"ids"`
+	}
+	if err := a.db.collection(a.cfg.Name).FindOne(ctx, bson.M{"_id": a.cfg.Name}).Decode(&doc); err != nil {
+		return AllocatorStats{}, wrapError(op, err)
+	}
+	return a.stats(a.capacity() - int64(len(doc.IDs))), nil
+}
+
+type insertAllocator struct {
+	allocator
+}
+
+func (a *insertAllocator) Allocate(ctx context.Context) (int32, error) {
+	return a.db.GetIDFromInsertPoolWithContext(ctx, a.cfg.Name)
+}
+
+func (a *insertAllocator) Release(ctx context.Context, id int32) error {
+	if err := a.checkRange("Allocator.Release", id); err != nil {
+		return err
+	}
+	return a.db.ReleaseIDToInsertPoolWithContext(ctx, a.cfg.Name, id)
+}
+
+func (a *insertAllocator) Reserve(ctx context.Context, id int32) error {
+	const op = "Allocator.Reserve"
+	if err := a.checkRange(op, id); err != nil {
+		return err
+	}
+	claimed, err := a.db.claimID(ctx, a.cfg.Name, int(id))
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if !claimed {
+		return newError(op, ErrAlreadyAllocated, nil)
+	}
+	return nil
+}
+
+func (a *insertAllocator) Stats(ctx context.Context) (AllocatorStats, error) {
+	const op = "Allocator.Stats"
+	allocated, err := a.db.collection(a.cfg.Name).CountDocuments(ctx,
+		bson.M{"_id": bson.M{"$gte": a.cfg.Min, "$lt": a.cfg.Max}})
+	if err != nil {
+		return AllocatorStats{}, wrapError(op, err)
+	}
+	return a.stats(allocated), nil
+}
+
+/* counterAllocator hands out the ids of GetUniqueIdentity, so that they never collide with the ids its callers get.
+ * All counter allocators share that one counter, Name only identifies the configuration. */
+type counterAllocator struct {
+	allocator
+}
+
+func (a *counterAllocator) Allocate(ctx context.Context) (int32, error) {
+	const op = "Allocator.Allocate"
+	for {
+		id, err := a.db.GetUniqueIdentityWithContext(ctx)
+		if err != nil {
+			return -1, err
+		}
+		if id >= a.cfg.Max {
+			return -1, newError(op, ErrPoolExhausted, fmt.Errorf("the counter passed %d", a.cfg.Max))
+		}
+		if id >= a.cfg.Min {
+			return id, nil
+		}
+		// the counter was reset below the range.
+		if err := a.raise(ctx); err != nil {
+			return -1, wrapError(op, err)
+		}
+	}
+}
+
+func (a *counterAllocator) Release(ctx context.Context, id int32) error {
+	return newError("Allocator.Release", ErrUnsupported, nil)
+}
+
+func (a *counterAllocator) Reserve(ctx context.Context, id int32) error {
+	return newError("Allocator.Reserve", ErrUnsupported, nil)
+}
+
+/* Stats counts the ids of the range the counter has passed as allocated, including those handed out by
+ * GetUniqueIdentity. */
+func (a *counterAllocator) Stats(ctx context.Context) (AllocatorStats, error) {
+	const op = "Allocator.Stats"
+	var doc struct {
+		Count int64 `bson:"count"`
+	}
+	err := a.db.collection(uniqueIdentityCollection).FindOne(ctx, bson.M{"_id": uniqueIdentityID}).Decode(&doc)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return AllocatorStats{}, wrapError(op, err)
+	}
+	// count is the next id to be handed out.
+	allocated := doc.Count - int64(a.cfg.Min)
+	if allocated < 0 {
+		allocated = 0
+	} else if allocated > a.capacity() {
+		allocated = a.capacity()
+	}
+	return a.stats(allocated), nil
+}
+
+/* Raise the counter of GetUniqueIdentity to Min, so that the ids below the range are not handed out one by one. */
+func (a *counterAllocator) raise(ctx context.Context) error {
+	_, err := a.db.collection(uniqueIdentityCollection).UpdateOne(ctx, bson.M{"_id": uniqueIdentityID},
+		bson.M{"$max": bson.M{"count": a.cfg.Min}}, options.Update().SetUpsert(true))
+	return err
+}
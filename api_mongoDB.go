@@ -8,594 +8,459 @@ package MongoDBLibrary
 
 import (
 	"context"
-	"encoding/json"
-	"time"
-	"errors"
-	"math/rand"
-	"os"
 
-	jsonpatch "github.com/evanphx/json-patch"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/x/bsonx"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/free5gc/MongoDBLibrary/logger"
 )
 
-var Client *mongo.Client = nil
-var dbName string
-var pools = map[string]map[string]int{}
+// The package level functions below operate on the default instance, see DefaultDB and SetDefaultDB.
 
 func SetMongoDB(setdbName string, url string) {
+	if err := SetMongoDBWithError(setdbName, url); err != nil {
+		logger.MongoDBLog.Panic(err.Error())
+	}
+}
+
+func SetMongoDBWithError(setdbName string, url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultConnectTimeout)
+	defer cancel()
+	return SetMongoDBWithContext(ctx, setdbName, url)
+}
 
+func SetMongoDBWithContext(ctx context.Context, setdbName string, url string) error {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
 	if Client != nil {
-		return
+		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
-	defer cancel()
+	db, err := NewDBWithContext(ctx, setdbName, url, nil)
 	if err != nil {
-		//defer cancel()
-		logger.MongoDBLog.Panic(err.Error())
+		return wrapError("SetMongoDB", err)
 	}
-	Client = client
-	dbName = setdbName
+	setDefaultDB(db)
+	return nil
 }
 
 func RestfulAPIGetOne(collName string, filter bson.M) map[string]interface{} {
+	return DefaultDB().RestfulAPIGetOne(collName, filter)
+}
 
-	collection := Client.Database(dbName).Collection(collName)
-
-	var result map[string]interface{}
-	collection.FindOne(context.TODO(), filter).Decode(&result)
+func RestfulAPIGetOneWithError(collName string, filter bson.M) (map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIGetOneWithError(collName, filter)
+}
 
-	return result
+func RestfulAPIGetOneWithContext(ctx context.Context, collName string,
+	filter bson.M) (map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIGetOneWithContext(ctx, collName, filter)
 }
 
 func RestfulAPIGetMany(collName string, filter bson.M) []map[string]interface{} {
-	collection := Client.Database(dbName).Collection(collName)
-
-	var resultArray []map[string]interface{}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	cur, err := collection.Find(ctx, filter)
-	defer cancel()
-	if err != nil {
-		logger.MongoDBLog.Fatal(err)
-	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result map[string]interface{}
-		err := cur.Decode(&result)
-		if err != nil {
-			logger.MongoDBLog.Fatal(err)
-		}
-		resultArray = append(resultArray, result)
-	}
-	if err := cur.Err(); err != nil {
-		logger.MongoDBLog.Fatal(err)
-	}
+	return DefaultDB().RestfulAPIGetMany(collName, filter)
+}
 
-	return resultArray
+func RestfulAPIGetManyWithError(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIGetManyWithError(collName, filter)
+}
 
+func RestfulAPIGetManyWithContext(ctx context.Context, collName string,
+	filter bson.M) ([]map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIGetManyWithContext(ctx, collName, filter)
 }
 
 /* Get unique identity from counter collection. */
 func GetUniqueIdentity() int32 {
-	counterCollection := Client.Database(dbName).Collection("counter")
-
-	counterFilter := bson.M{}
-	counterFilter["_id"] = "uniqueIdentity"
-
-	for {
-		count := counterCollection.FindOneAndUpdate(context.TODO(), counterFilter, bson.M{"$inc": bson.M{"count": 1}})
-
-		if count.Err() != nil {
-			counterData := bson.M{}
-			counterData["count"] = 1
-			counterData["_id"] = "uniqueIdentity"
-			counterCollection.InsertOne(context.TODO(), counterData)
-			
-			continue
-		} else {
-			data := bson.M{}
-			count.Decode(&data)
-			decodedCount := data["count"].(int32)
-			return decodedCount
-		}
-	}
+	return DefaultDB().GetUniqueIdentity()
+}
+
+func GetUniqueIdentityWithError() (int32, error) {
+	return DefaultDB().GetUniqueIdentityWithError()
+}
+
+func GetUniqueIdentityWithContext(ctx context.Context) (int32, error) {
+	return DefaultDB().GetUniqueIdentityWithContext(ctx)
 }
 
 /* Get a unique id within a given range. */
 func GetUniqueIdentityWithinRange(min int32, max int32) int32 {
-	rangeCollection := Client.Database(dbName).Collection("range")
-
-	rangeFilter := bson.M{}
-	rangeFilter["_id"] = "uniqueIdentity"
-
-	for {
-		count := rangeCollection.FindOneAndUpdate(context.TODO(), rangeFilter, bson.M{"$inc": bson.M{"count": 1}})
-
-		if count.Err() != nil {
-			counterData := bson.M{}
-			counterData["count"] = min
-			counterData["_id"] = "uniqueIdentity"
-			rangeCollection.InsertOne(context.TODO(), counterData)
-			
-			continue
-		} else {
-			data := bson.M{}
-			count.Decode(&data)
-			decodedCount := data["count"].(int32)
-
-			if (decodedCount >= max || decodedCount <= min) {
-				err := errors.New("Unique identity is out of range.")
-				logger.MongoDBLog.Println(err)
-				return -1
-			}
-			return decodedCount
-		}
-	}
+	return DefaultDB().GetUniqueIdentityWithinRange(min, max)
+}
+
+func GetUniqueIdentityWithinRangeWithError(min int32, max int32) (int32, error) {
+	return DefaultDB().GetUniqueIdentityWithinRangeWithError(min, max)
+}
+
+func GetUniqueIdentityWithinRangeWithContext(ctx context.Context, min int32, max int32) (int32, error) {
+	return DefaultDB().GetUniqueIdentityWithinRangeWithContext(ctx, min, max)
 }
 
 /* Initialize pool of ids with max and min values and chunk size and amount of retries to get a chunk. */
 func InitializeChunkPool(poolName string, min int, max int, retries int, chunkSize int) {
-	logger.MongoDBLog.Println("ENTERING InitializeChunkPool")
-	var poolData = map[string]int{}
-	poolData["min"] = min
-	poolData["max"] = max
-	poolData["retries"] = retries
-	poolData["chunkSize"] = chunkSize
+	DefaultDB().InitializeChunkPool(poolName, min, max, retries, chunkSize)
+}
 
-	pools[poolName] = poolData
-	logger.MongoDBLog.Println("Pools: ", pools)
+func InitializeChunkPoolWithError(poolName string, min int, max int, retries int, chunkSize int) error {
+	return DefaultDB().InitializeChunkPoolWithError(poolName, min, max, retries, chunkSize)
+}
+
+func InitializeChunkPoolWithContext(ctx context.Context, poolName string, min int, max int, retries int,
+	chunkSize int) error {
+	return DefaultDB().InitializeChunkPoolWithContext(ctx, poolName, min, max, retries, chunkSize)
 }
 
 /* Get id by inserting into collection. If insert succeeds, that id is available. Else, it isn't available so retry. */
 func GetChunkFromPool(poolName string) (int32, int32, int32, error) {
-	logger.MongoDBLog.Println("ENTERING GetChunkFromPool")
-
-	var pool = pools[poolName]
-
-	if pool == nil {
-		err := errors.New("This pool has not been initialized yet. Initialize by calling InitializeChunkPool.")
-		return -1, -1, -1, err
-	} 
-
-	min := pool["min"]
-	max := pool["max"]
-	retries := pool["retries"]
-	chunkSize := pool["chunkSize"]
-	totalChunks := int((max - min)/chunkSize) 
-
-	i := 0
-	for i < retries {
-		random := rand.Intn(totalChunks)
-		lower := min + (random*chunkSize)
-		upper := lower + chunkSize
-		poolCollection := Client.Database(dbName).Collection(poolName)
-
-		// Create an instance of an options and set the desired options
-		upsert := true
-		opt := options.FindOneAndUpdateOptions{
-			Upsert: &upsert,
-		}
-		data := bson.M{}
-		data["_id"] = random
-		data["lower"] = lower
-		data["upper"] = upper
-		data["owner"] = os.Getenv("HOSTNAME")
-		result := poolCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": random}, bson.M{"$setOnInsert": data}, &opt)
-
-		if result.Err() != nil {
-			// means that there was no document with that id, so the upsert should have been successful 
-			if (result.Err() == mongo.ErrNoDocuments) {
-				logger.MongoDBLog.Println("Assigned chunk # ", random, " with range ", lower, " - ", upper)
-				return int32(random), int32(lower), int32(upper), nil
-			}
-			
-			return -1, -1, -1, result.Err()
-		}
-		// means there was a document before the update and result contains that document. 
-		logger.MongoDBLog.Println("Chunk", random, " has already been assigned. ", retries - i - 1, " retries left.")
-		i++
-	}
+	return DefaultDB().GetChunkFromPool(poolName)
+}
 
-	err := errors.New("No id found after retries")
-	return -1, -1, -1, err
+func GetChunkFromPoolWithContext(ctx context.Context, poolName string) (int32, int32, int32, error) {
+	return DefaultDB().GetChunkFromPoolWithContext(ctx, poolName)
 }
 
 /* Release the provided id to the provided pool. */
 func ReleaseChunkToPool(poolName string, id int32) {
-	logger.MongoDBLog.Println("ENTERING ReleaseChunkToPool")
-	poolCollection := Client.Database(dbName).Collection(poolName)
+	DefaultDB().ReleaseChunkToPool(poolName, id)
+}
 
-	// only want to delete if the currentApp is the owner of this id. 
-	currentApp := os.Getenv("HOSTNAME")
-	logger.MongoDBLog.Println(currentApp)
+func ReleaseChunkToPoolWithError(poolName string, id int32) error {
+	return DefaultDB().ReleaseChunkToPoolWithError(poolName, id)
+}
 
-	_, err := poolCollection.DeleteOne(context.TODO(), bson.M{"_id": id, "owner": currentApp})
-	if (err != nil) {
-		logger.MongoDBLog.Panic(err)
-	}
+func ReleaseChunkToPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	return DefaultDB().ReleaseChunkToPoolWithContext(ctx, poolName, id)
 }
 
 /* Initialize pool of ids with max and min values. */
 func InitializeInsertPool(poolName string, min int, max int, retries int) {
-	logger.MongoDBLog.Println("ENTERING InitializeInsertPool")
-	var poolData = map[string]int{}
-	poolData["min"] = min
-	poolData["max"] = max
-	poolData["retries"] = retries
+	DefaultDB().InitializeInsertPool(poolName, min, max, retries)
+}
+
+func InitializeInsertPoolWithError(poolName string, min int, max int, retries int) error {
+	return DefaultDB().InitializeInsertPoolWithError(poolName, min, max, retries)
+}
 
-	pools[poolName] = poolData
-	logger.MongoDBLog.Println("Pools: ", pools)
+func InitializeInsertPoolWithContext(ctx context.Context, poolName string, min int, max int, retries int) error {
+	return DefaultDB().InitializeInsertPoolWithContext(ctx, poolName, min, max, retries)
 }
 
 /* Get id by inserting into collection. If insert succeeds, that id is available. Else, it isn't available so retry. */
 func GetIDFromInsertPool(poolName string) (int32, error) {
-	logger.MongoDBLog.Println("ENTERING GetIDFromInsertPool")
-
-	var pool = pools[poolName]
-
-	if pool == nil {
-		err := errors.New("This pool has not been initialized yet. Initialize by calling InitializeInsertPool.")
-		return -1, err
-	} 
-
-	min := pool["min"]
-	max := pool["max"]
-	retries := pool["retries"]
-	i := 0
-	for i < retries {
-		random := rand.Intn(max - min) + min // returns random int in [0, max-min-1] + min 
-		poolCollection := Client.Database(dbName).Collection(poolName)
-
-		// Create an instance of an options and set the desired options
-		upsert := true
-		opt := options.FindOneAndUpdateOptions{
-			Upsert: &upsert,
-		}
-		result := poolCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": random}, bson.M{"$set": bson.M{"_id": random}}, &opt)
-
-		if result.Err() != nil {
-			// means that there was no document with that id, so the upsert should have been successful 
-			if result.Err().Error() == "mongo: no documents in result" {
-				logger.MongoDBLog.Println("Assigned id: ", random)
-				return int32(random), nil
-			}
-			
-			return -1, result.Err()
-		}
-		// means there was a document before the update and result contains that document. 
-		logger.MongoDBLog.Println("This id has already been assigned. ")
-		doc := bson.M{}
-		result.Decode(&doc)
-		logger.MongoDBLog.Println(doc)
-
-		i++
-	}
+	return DefaultDB().GetIDFromInsertPool(poolName)
+}
 
-	err := errors.New("No id found after retries")
-	return -1, err
+func GetIDFromInsertPoolWithContext(ctx context.Context, poolName string) (int32, error) {
+	return DefaultDB().GetIDFromInsertPoolWithContext(ctx, poolName)
 }
 
 /* Release the provided id to the provided pool. */
 func ReleaseIDToInsertPool(poolName string, id int32) {
-	logger.MongoDBLog.Println("ENTERING ReleaseIDToInsertPool")
-	poolCollection := Client.Database(dbName).Collection(poolName)
+	DefaultDB().ReleaseIDToInsertPool(poolName, id)
+}
 
-	_, err := poolCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
-	if (err != nil) {
-		logger.MongoDBLog.Panic(err)
-	}
+func ReleaseIDToInsertPoolWithError(poolName string, id int32) error {
+	return DefaultDB().ReleaseIDToInsertPoolWithError(poolName, id)
+}
+
+func ReleaseIDToInsertPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	return DefaultDB().ReleaseIDToInsertPoolWithContext(ctx, poolName, id)
 }
 
 /* Initialize pool of ids with max and min values. */
 func InitializePool(poolName string, min int32, max int32) {
-	logger.MongoDBLog.Println("ENTERING InitializePool")
-	poolCollection := Client.Database(dbName).Collection(poolName)
-	names, err := Client.Database(dbName).ListCollectionNames(context.TODO(), bson.M{})
-	if err != nil {
-		logger.MongoDBLog.Println(err)
-		return
-	}
+	DefaultDB().InitializePool(poolName, min, max)
+}
 
-	logger.MongoDBLog.Println(names);
+func InitializePoolWithError(poolName string, min int32, max int32) error {
+	return DefaultDB().InitializePoolWithError(poolName, min, max)
+}
 
-	exists := false
-	for _, name := range names {
-		if name == poolName {
-			logger.MongoDBLog.Println("The collection exists!")
-			exists = true
-			break
-		}
-	}
-	if !exists {
-		logger.MongoDBLog.Println("Creating collection")
-
-		array := []int32{}
-		for i := min; i < max; i++ {
-			array = append(array, i)
-		}
-		poolData := bson.M{}
-		poolData["ids"] = array
-		poolData["_id"] = poolName
-
-		// collection is created when inserting document. 
-		// "If a collection does not exist, MongoDB creates the collection when you first store data for that collection."
-		poolCollection.InsertOne(context.TODO(), poolData)
-	}
+func InitializePoolWithContext(ctx context.Context, poolName string, min int32, max int32) error {
+	return DefaultDB().InitializePoolWithContext(ctx, poolName, min, max)
 }
 
 /* For example IP addresses need to be assigned and then returned to be used again. */
 func GetIDFromPool(poolName string) (int32, error) {
-	logger.MongoDBLog.Println("ENTERING GetIDFromPool")
-	poolCollection := Client.Database(dbName).Collection(poolName)
-
-	result := bson.M{}
-	poolCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": poolName}, bson.M{"$pop": bson.M{"ids":1}}).Decode(&result)
-
-	var array []int32
-	interfaces := []interface{}(result["ids"].(primitive.A))
-	for _, s := range interfaces {
-		id := s.(int32)
-		array = append(array, id)
-	}
+	return DefaultDB().GetIDFromPool(poolName)
+}
 
-	logger.MongoDBLog.Println("Array of ids: ", array)
-	if len(array) > 0 {
-		res := array[len(array) - 1]
-		return res, nil
-	} else {
-		err := errors.New("There are no available ids.")
-		logger.MongoDBLog.Println(err)
-		return -1, err
-	}
+func GetIDFromPoolWithContext(ctx context.Context, poolName string) (int32, error) {
+	return DefaultDB().GetIDFromPoolWithContext(ctx, poolName)
 }
 
 /* Release the provided id to the provided pool. */
 func ReleaseIDToPool(poolName string, id int32) {
-	logger.MongoDBLog.Println("ENTERING ReleaseIDToPool")
-	poolCollection := Client.Database(dbName).Collection(poolName)
-
-	poolCollection.UpdateOne(context.TODO(), bson.M{"_id": poolName}, bson.M{"$push": bson.M{"ids":id}})
+	DefaultDB().ReleaseIDToPool(poolName, id)
 }
 
-func GetOneCustomDataStructure(collName string, filter bson.M) (bson.M, error) {
-	collection := Client.Database(dbName).Collection(collName)
+func ReleaseIDToPoolWithError(poolName string, id int32) error {
+	return DefaultDB().ReleaseIDToPoolWithError(poolName, id)
+}
 
-	val := collection.FindOne(context.TODO(), filter)
+func ReleaseIDToPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	return DefaultDB().ReleaseIDToPoolWithContext(ctx, poolName, id)
+}
 
-	if val.Err() != nil {
-		logger.MongoDBLog.Println("Error getting student from db: " + val.Err().Error())
-		return bson.M{}, val.Err()
-	}
+func GetOneCustomDataStructure(collName string, filter bson.M) (bson.M, error) {
+	return DefaultDB().GetOneCustomDataStructure(collName, filter)
+}
 
-	var result bson.M
-	err := val.Decode(&result)
-	return result, err
+func GetOneCustomDataStructureWithContext(ctx context.Context, collName string, filter bson.M) (bson.M,
+	error) {
+	return DefaultDB().GetOneCustomDataStructureWithContext(ctx, collName, filter)
 }
 
 func PutOneCustomDataStructure(collName string, filter bson.M, putData interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
-
-	var checkItem map[string] interface{}
-	collection.FindOne(context.TODO(), filter).Decode(&checkItem)
-
-	if checkItem == nil {
-		collection.InsertOne(context.TODO(), putData)
-		return false
-	} else {
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": putData})
-		return true
-	}
+	return DefaultDB().PutOneCustomDataStructure(collName, filter, putData)
 }
 
-func PutOneWithTimeout(collName string, filter bson.M, putData map[string]interface{}, timeout int32, timeField string) bool {
-	collection := Client.Database(dbName).Collection(collName)
-	var checkItem map[string]interface{}
+func PutOneCustomDataStructureWithError(collName string, filter bson.M, putData interface{}) (bool, error) {
+	return DefaultDB().PutOneCustomDataStructureWithError(collName, filter, putData)
+}
 
-	// TTL index
-	index := mongo.IndexModel{
-		Keys:    bsonx.Doc{{Key: timeField, Value: bsonx.Int32(1)}},
-		Options: options.Index().SetExpireAfterSeconds(timeout),
-	}
+func PutOneCustomDataStructureWithContext(ctx context.Context, collName string, filter bson.M,
+	putData interface{}) (bool, error) {
+	return DefaultDB().PutOneCustomDataStructureWithContext(ctx, collName, filter, putData)
+}
 
-	_, err := collection.Indexes().CreateOne(context.Background(), index)
-	if err != nil {
-		logger.MongoDBLog.Panic(err)
-	}
+func PutOneWithTimeout(collName string, filter bson.M, putData map[string]interface{}, timeout int32,
+	timeField string) bool {
+	return DefaultDB().PutOneWithTimeout(collName, filter, putData, timeout, timeField)
+}
 
-	collection.FindOne(context.TODO(), filter).Decode(&checkItem)
+func PutOneWithTimeoutWithError(collName string, filter bson.M, putData map[string]interface{}, timeout int32,
+	timeField string) (bool, error) {
+	return DefaultDB().PutOneWithTimeoutWithError(collName, filter, putData, timeout, timeField)
+}
 
-	if checkItem == nil {
-		collection.InsertOne(context.TODO(), putData)
-		return false
-	} else {
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": putData})
-		return true
-	}
+func PutOneWithTimeoutWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}, timeout int32, timeField string) (bool, error) {
+	return DefaultDB().PutOneWithTimeoutWithContext(ctx, collName, filter, putData, timeout, timeField)
 }
 
 func RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
+	return DefaultDB().RestfulAPIPutOne(collName, filter, putData)
+}
 
-	var checkItem map[string]interface{}
-	collection.FindOne(context.TODO(), filter).Decode(&checkItem)
+func RestfulAPIPutOneWithError(collName string, filter bson.M, putData map[string]interface{},
+	opts ...*WriteOptions) (bool, error) {
+	return DefaultDB().RestfulAPIPutOneWithError(collName, filter, putData, opts...)
+}
 
-	if checkItem == nil {
-		collection.InsertOne(context.TODO(), putData)
-		return false
-	} else {
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": putData})
-		return true
-	}
+func RestfulAPIPutOneWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}, opts ...*WriteOptions) (bool, error) {
+	return DefaultDB().RestfulAPIPutOneWithContext(ctx, collName, filter, putData, opts...)
 }
 
 func RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
+	return DefaultDB().RestfulAPIPutOneNotUpdate(collName, filter, putData)
+}
 
-	var checkItem map[string]interface{}
-	collection.FindOne(context.TODO(), filter).Decode(&checkItem)
+func RestfulAPIPutOneNotUpdateWithError(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	return DefaultDB().RestfulAPIPutOneNotUpdateWithError(collName, filter, putData)
+}
 
-	if checkItem == nil {
-		collection.InsertOne(context.TODO(), putData)
-		return false
-	} else {
-		// collection.UpdateOne(context.TODO(), filter, bson.M{"$set": putData})
-		return true
-	}
+func RestfulAPIPutOneNotUpdateWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}) (bool, error) {
+	return DefaultDB().RestfulAPIPutOneNotUpdateWithContext(ctx, collName, filter, putData)
 }
 
 func RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
-
-	var checkItem map[string]interface{}
-	for i, putData := range putDataArray {
-		checkItem = nil
-		filter := filterArray[i]
-		collection.FindOne(context.TODO(), filter).Decode(&checkItem)
-
-		if checkItem == nil {
-			collection.InsertOne(context.TODO(), putData)
-		} else {
-			collection.UpdateOne(context.TODO(), filter, bson.M{"$set": putData})
-		}
-	}
+	return DefaultDB().RestfulAPIPutMany(collName, filterArray, putDataArray)
+}
 
-	if checkItem == nil {
-		return false
-	} else {
-		return true
-	}
+func RestfulAPIPutManyWithError(collName string, filterArray []bson.M,
+	putDataArray []map[string]interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	return DefaultDB().RestfulAPIPutManyWithError(collName, filterArray, putDataArray, opts...)
+}
 
+func RestfulAPIPutManyWithContext(ctx context.Context, collName string, filterArray []bson.M,
+	putDataArray []map[string]interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	return DefaultDB().RestfulAPIPutManyWithContext(ctx, collName, filterArray, putDataArray, opts...)
 }
 
 func RestfulAPIDeleteOne(collName string, filter bson.M) {
-	collection := Client.Database(dbName).Collection(collName)
+	DefaultDB().RestfulAPIDeleteOne(collName, filter)
+}
+
+func RestfulAPIDeleteOneWithError(collName string, filter bson.M, opts ...*WriteOptions) (int64, error) {
+	return DefaultDB().RestfulAPIDeleteOneWithError(collName, filter, opts...)
+}
 
-	collection.DeleteOne(context.TODO(), filter)
+func RestfulAPIDeleteOneWithContext(ctx context.Context, collName string, filter bson.M,
+	opts ...*WriteOptions) (int64, error) {
+	return DefaultDB().RestfulAPIDeleteOneWithContext(ctx, collName, filter, opts...)
 }
 
 func RestfulAPIDeleteMany(collName string, filter bson.M) {
-	collection := Client.Database(dbName).Collection(collName)
+	DefaultDB().RestfulAPIDeleteMany(collName, filter)
+}
 
-	collection.DeleteMany(context.TODO(), filter)
+func RestfulAPIDeleteManyWithError(collName string, filter bson.M) (int64, error) {
+	return DefaultDB().RestfulAPIDeleteManyWithError(collName, filter)
+}
+
+func RestfulAPIDeleteManyWithContext(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	return DefaultDB().RestfulAPIDeleteManyWithContext(ctx, collName, filter)
 }
 
 func RestfulAPIMergePatch(collName string, filter bson.M, patchData map[string]interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
+	return DefaultDB().RestfulAPIMergePatch(collName, filter, patchData)
+}
 
-	var originalData map[string]interface{}
-	result := collection.FindOne(context.TODO(), filter)
+func RestfulAPIMergePatchWithError(collName string, filter bson.M, patchData map[string]interface{},
+	opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIMergePatchWithError(collName, filter, patchData, opts...)
+}
 
-	if err := result.Decode(&originalData); err != nil { // Data doesn't exist in DB
-		return false
-	} else {
-		delete(originalData, "_id")
-		original, _ := json.Marshal(originalData)
+func RestfulAPIMergePatchWithContext(ctx context.Context, collName string, filter bson.M,
+	patchData map[string]interface{}, opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIMergePatchWithContext(ctx, collName, filter, patchData, opts...)
+}
 
-		patchDataByte, err := json.Marshal(patchData)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
+func RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) bool {
+	return DefaultDB().RestfulAPIJSONPatch(collName, filter, patchJSON)
+}
 
-		modifiedAlternative, err := jsonpatch.MergePatch(original, patchDataByte)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
+func RestfulAPIJSONPatchWithError(collName string, filter bson.M, patchJSON []byte, opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIJSONPatchWithError(collName, filter, patchJSON, opts...)
+}
 
-		var modifiedData map[string]interface{}
+func RestfulAPIJSONPatchWithContext(ctx context.Context, collName string, filter bson.M,
+	patchJSON []byte, opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIJSONPatchWithContext(ctx, collName, filter, patchJSON, opts...)
+}
 
-		json.Unmarshal(modifiedAlternative, &modifiedData)
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": modifiedData})
-		return true
-	}
+func RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) bool {
+	return DefaultDB().RestfulAPIJSONPatchExtend(collName, filter, patchJSON, dataName)
 }
 
-func RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) bool {
-	collection := Client.Database(dbName).Collection(collName)
+func RestfulAPIJSONPatchExtendWithError(collName string, filter bson.M, patchJSON []byte, dataName string,
+	opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIJSONPatchExtendWithError(collName, filter, patchJSON, dataName, opts...)
+}
 
-	var originalData map[string]interface{}
-	result := collection.FindOne(context.TODO(), filter)
+func RestfulAPIJSONPatchExtendWithContext(ctx context.Context, collName string, filter bson.M,
+	patchJSON []byte, dataName string, opts ...*WriteOptions) error {
+	return DefaultDB().RestfulAPIJSONPatchExtendWithContext(ctx, collName, filter, patchJSON, dataName, opts...)
+}
 
-	if err := result.Decode(&originalData); err != nil { // Data doesn't exist in DB
-		return false
-	} else {
-		delete(originalData, "_id")
-		original, _ := json.Marshal(originalData)
+func RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) bool {
+	return DefaultDB().RestfulAPIPost(collName, filter, postData)
+}
 
-		patch, err := jsonpatch.DecodePatch(patchJSON)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
+func RestfulAPIPostWithError(collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	return DefaultDB().RestfulAPIPostWithError(collName, filter, postData)
+}
 
-		modified, err := patch.Apply(original)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
+func RestfulAPIPostWithContext(ctx context.Context, collName string, filter bson.M,
+	postData map[string]interface{}) (bool, error) {
+	return DefaultDB().RestfulAPIPostWithContext(ctx, collName, filter, postData)
+}
 
-		var modifiedData map[string]interface{}
+func RestfulAPIPostMany(collName string, filter bson.M, postDataArray []interface{}) bool {
+	return DefaultDB().RestfulAPIPostMany(collName, filter, postDataArray)
+}
 
-		json.Unmarshal(modified, &modifiedData)
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": modifiedData})
-		return true
-	}
+func RestfulAPIPostManyWithError(collName string, filter bson.M, postDataArray []interface{},
+	opts ...*BulkOptions) (*BulkResult, error) {
+	return DefaultDB().RestfulAPIPostManyWithError(collName, filter, postDataArray, opts...)
+}
 
+func RestfulAPIPostManyWithContext(ctx context.Context, collName string, filter bson.M,
+	postDataArray []interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	return DefaultDB().RestfulAPIPostManyWithContext(ctx, collName, filter, postDataArray, opts...)
 }
 
-func RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) bool {
-	collection := Client.Database(dbName).Collection(collName)
-
-	var originalDataCover map[string]interface{}
-	result := collection.FindOne(context.TODO(), filter)
-
-	if err := result.Decode(&originalDataCover); err != nil { // Data does'nt exist in db
-		return false
-	} else {
-		delete(originalDataCover, "_id")
-		originalData := originalDataCover[dataName]
-		original, _ := json.Marshal(originalData)
-
-		jsonpatch.DecodePatch(patchJSON)
-		patch, err := jsonpatch.DecodePatch(patchJSON)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
-
-		modified, err := patch.Apply(original)
-		if err != nil {
-			logger.MongoDBLog.Panic(err)
-		}
-
-		var modifiedData map[string]interface{}
-		json.Unmarshal(modified, &modifiedData)
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{dataName: modifiedData}})
-		return true
-	}
+func EnsureUniqueIndex(ctx context.Context, collName string, fields ...string) error {
+	return DefaultDB().EnsureUniqueIndex(ctx, collName, fields...)
 }
 
-func RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
+func RestfulAPIGetPage(ctx context.Context, collName string, filter bson.M, opts *QueryOptions) (*Page, error) {
+	return DefaultDB().RestfulAPIGetPage(ctx, collName, filter, opts)
+}
 
-	var checkItem map[string]interface{}
-	collection.FindOne(context.TODO(), filter).Decode(&checkItem)
+func Iterate(ctx context.Context, collName string, filter bson.M, opts *QueryOptions) (*Iterator, error) {
+	return DefaultDB().Iterate(ctx, collName, filter, opts)
+}
 
-	if checkItem == nil {
-		collection.InsertOne(context.TODO(), postData)
-		return false
-	} else {
-		collection.UpdateOne(context.TODO(), filter, bson.M{"$set": postData})
-		return true
-	}
+func ForEach(ctx context.Context, collName string, filter bson.M, opts *QueryOptions,
+	fn func(it *Iterator) error) error {
+	return DefaultDB().ForEach(ctx, collName, filter, opts, fn)
 }
 
-func RestfulAPIPostMany(collName string, filter bson.M, postDataArray []interface{}) bool {
-	collection := Client.Database(dbName).Collection(collName)
+func RestfulAPIGetOneWithETag(ctx context.Context, collName string,
+	filter bson.M) (map[string]interface{}, string, error) {
+	return DefaultDB().RestfulAPIGetOneWithETag(ctx, collName, filter)
+}
+
+func RestfulAPIGetManyWithETag(ctx context.Context, collName string,
+	filter bson.M) ([]map[string]interface{}, []string, error) {
+	return DefaultDB().RestfulAPIGetManyWithETag(ctx, collName, filter)
+}
+
+func RestfulAPIFindOneAndDelete(ctx context.Context, collName string, filter bson.M,
+	opts ...*WriteOptions) (map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIFindOneAndDelete(ctx, collName, filter, opts...)
+}
+
+func RestfulAPIFindManyAndDelete(ctx context.Context, collName string,
+	filter bson.M) ([]map[string]interface{}, error) {
+	return DefaultDB().RestfulAPIFindManyAndDelete(ctx, collName, filter)
+}
+
+func EnableSoftDelete(ctx context.Context, collName string, opts *SoftDeleteOptions) error {
+	return DefaultDB().EnableSoftDelete(ctx, collName, opts)
+}
+
+func RestoreDeleted(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	return DefaultDB().RestoreDeleted(ctx, collName, filter)
+}
+
+func PurgeDeleted(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	return DefaultDB().PurgeDeleted(ctx, collName, filter)
+}
+
+func WithTransaction(ctx context.Context, fn func(tx *Tx) error, opts ...*TxOptions) error {
+	return DefaultDB().WithTransaction(ctx, fn, opts...)
+}
+
+func Watch(ctx context.Context, collName string, filter bson.M, handler func(event ChangeEvent) error,
+	opts *WatchOptions) (*Watcher, error) {
+	return DefaultDB().Watch(ctx, collName, filter, handler, opts)
+}
+
+func EnableCache(ctx context.Context, collName string, opts *CacheOptions) error {
+	return DefaultDB().EnableCache(ctx, collName, opts)
+}
+
+func DisableCache(collName string) {
+	DefaultDB().DisableCache(collName)
+}
+
+func GetCacheStats(collName string) (CacheStats, bool) {
+	return DefaultDB().GetCacheStats(collName)
+}
+
+func DeclareIndexes(collName string, indexes ...Index) error {
+	return DefaultDB().DeclareIndexes(collName, indexes...)
+}
+
+func EnsureIndexes(ctx context.Context, opts *EnsureIndexesOptions) (*IndexReport, error) {
+	return DefaultDB().EnsureIndexes(ctx, opts)
+}
+
+func NewAllocator(ctx context.Context, cfg AllocatorConfig) (Allocator, error) {
+	return DefaultDB().NewAllocator(ctx, cfg)
+}
+
+func AcquireChunkLease(ctx context.Context, poolName string, opts *LeaseOptions) (*ChunkLease, error) {
+	return DefaultDB().AcquireChunkLease(ctx, poolName, opts)
+}
+
+func MigrateChunkPool(ctx context.Context, poolName string) (int64, error) {
+	return DefaultDB().MigrateChunkPool(ctx, poolName)
+}
 
-	collection.InsertMany(context.TODO(), postDataArray)
-	return false
+func NewLocalAllocator(ctx context.Context, poolName string, prefetchThreshold float64) (*LocalAllocator, error) {
+	return DefaultDB().NewLocalAllocator(ctx, poolName, prefetchThreshold)
 }
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* BulkOptions tunes RestfulAPIPutMany and RestfulAPIPostMany. */
+type BulkOptions struct {
+	// Unordered lets the server carry on after a failing item. By default the first failure stops the operation
+	// and the remaining items are reported as skipped.
+	Unordered bool
+	// BatchSize caps the number of items sent per BulkWrite call, 0 sends all items in one call.
+	BatchSize int
+}
+
+type BulkItemStatus int
+
+const (
+	BulkItemInserted BulkItemStatus = iota
+	BulkItemUpdated
+	BulkItemFailed
+	BulkItemSkipped
+)
+
+func (s BulkItemStatus) String() string {
+	switch s {
+	case BulkItemInserted:
+		return "inserted"
+	case BulkItemUpdated:
+		return "updated"
+	case BulkItemFailed:
+		return "failed"
+	case BulkItemSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+/* BulkItemResult reports what happened to one item, Err is set for failed and skipped items. */
+type BulkItemResult struct {
+	Status BulkItemStatus
+	Err    error
+}
+
+/* BulkResult holds one BulkItemResult per input item, in input order, plus totals. */
+type BulkResult struct {
+	Items    []BulkItemResult
+	Inserted int
+	Updated  int
+	Failed   int
+	Skipped  int
+}
+
+var errBulkSkipped = errors.New("not executed because an earlier item failed")
+
+func bulkOptions(opts []*BulkOptions) BulkOptions {
+	merged := BulkOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			merged = *opt
+		}
+	}
+	return merged
+}
+
+/* Run models through BulkWrite in batches and classify the outcome of every model. The returned error is set when
+ * at least one item did not succeed, the per-item details are in the result either way. */
+func (db *DB) bulkWrite(ctx context.Context, op string, collection *mongo.Collection, models []mongo.WriteModel,
+	opts BulkOptions) (*BulkResult, error) {
+	defer db.invalidateCache(collection.Name())
+	result := &BulkResult{Items: make([]BulkItemResult, len(models))}
+	if len(models) == 0 {
+		return result, nil
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > len(models) {
+		batchSize = len(models)
+	}
+	bulkOpt := options.BulkWrite().SetOrdered(!opts.Unordered)
+
+	var firstErr error
+	start := 0
+	for ; start < len(models); start += batchSize {
+		end := start + batchSize
+		if end > len(models) {
+			end = len(models)
+		}
+		res, err := collection.BulkWrite(ctx, models[start:end], bulkOpt)
+
+		failed := map[int]error{}
+		if err != nil {
+			var bwe mongo.BulkWriteException
+			if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+				// the batch as a whole failed, nothing of it or after it can be trusted to be written.
+				for i := start; i < len(models); i++ {
+					result.Items[i] = BulkItemResult{Status: BulkItemFailed, Err: wrapError(op, err)}
+				}
+				result.Failed += len(models) - start
+				return result, wrapError(op, err)
+			}
+			for _, we := range bwe.WriteErrors {
+				failed[we.Index] = wrapWriteError(op, we.WriteError)
+			}
+			if firstErr == nil {
+				firstErr = wrapError(op, err)
+			}
+		}
+
+		stopped := false
+		for i := 0; i < end-start; i++ {
+			item := &result.Items[start+i]
+			if itemErr, ok := failed[i]; ok {
+				*item = BulkItemResult{Status: BulkItemFailed, Err: itemErr}
+				result.Failed++
+				stopped = !opts.Unordered
+				continue
+			}
+			if stopped {
+				*item = BulkItemResult{Status: BulkItemSkipped, Err: errBulkSkipped}
+				result.Skipped++
+				continue
+			}
+			if _, upserted := res.UpsertedIDs[int64(i)]; upserted {
+				item.Status = BulkItemInserted
+			} else if _, inserted := models[start+i].(*mongo.InsertOneModel); inserted {
+				item.Status = BulkItemInserted
+			} else {
+				item.Status = BulkItemUpdated
+			}
+			if item.Status == BulkItemInserted {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+		}
+		if stopped {
+			start = end
+			break
+		}
+	}
+
+	for i := start; i < len(models); i++ {
+		result.Items[i] = BulkItemResult{Status: BulkItemSkipped, Err: errBulkSkipped}
+		result.Skipped++
+	}
+	return result, firstErr
+}
+
+/* Wrap the error of a single item of a bulk write. */
+func wrapWriteError(op string, we mongo.WriteError) error {
+	var kind error
+	switch we.Code {
+	case 11000, 11001, 12582:
+		kind = ErrDuplicateKey
+	}
+	return &Error{Op: op, Kind: kind, Err: we}
+}
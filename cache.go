@@ -0,0 +1,436 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+const defaultCacheEntries = 1000
+
+/* CacheOptions configures the read cache of a collection. */
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached results, the least recently used one is evicted first. Default 1000.
+	MaxEntries int
+	// TTL bounds how long a result is served from the cache, 0 keeps it until it is evicted or invalidated. It also
+	// bounds how stale a result can get while the change stream is reconnecting.
+	TTL time.Duration
+	// Refresh replaces the cached copy of an updated or replaced document with the new version instead of dropping
+	// it, when the filter it was read with is a plain equality filter that the new version still matches.
+	Refresh bool
+}
+
+/* CacheStats counts the work of a collection cache since it was enabled. */
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Refreshes     uint64
+	Entries       int
+}
+
+type cacheEntry struct {
+	key     string
+	filter  bson.M
+	id      string
+	value   interface{}
+	expires time.Time
+}
+
+/* cache keeps the results of RestfulAPIGetOne and RestfulAPIGetMany by filter, in least recently used order. */
+type cache struct {
+	opts    CacheOptions
+	watcher *Watcher
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	byID     map[string]map[string]bool // _id of a GetOne result to the keys caching it
+	manyKeys map[string]bool
+	// gen changes with every invalidation, results read before it changed are not stored.
+	gen   uint64
+	stats CacheStats
+}
+
+/* Cache the results of RestfulAPIGetOne and RestfulAPIGetMany on collName, and their WithError and WithContext
+ * variants. Results are cached by filter. A change stream on the collection invalidates the cached copies of
+ * documents that other processes change, so that the caches of several replicas stay coherent, and writes through
+ * db clear the cache of the collection right away. Reads inside a transaction bypass the cache.
+ *
+ * The cache stays enabled until ctx is done, DisableCache is called or the change stream fails for good, which is
+ * logged. Like the change stream it needs a replica set or a sharded cluster. Enabling it again replaces the
+ * existing cache. */
+func (db *DB) EnableCache(ctx context.Context, collName string, opts *CacheOptions) error {
+	const op = "EnableCache"
+	if err := db.check(op); err != nil {
+		return err
+	}
+	c := &cache{
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		byID:     map[string]map[string]bool{},
+		manyKeys: map[string]bool{},
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.MaxEntries <= 0 {
+		c.opts.MaxEntries = defaultCacheEntries
+	}
+
+	watcher, err := db.Watch(ctx, collName, nil, c.apply, &WatchOptions{FullDocument: c.opts.Refresh})
+	if err != nil {
+		return wrapError(op, err)
+	}
+	c.watcher = watcher
+
+	db.mu.Lock()
+	old := db.caches[collName]
+	db.caches[collName] = c
+	db.mu.Unlock()
+	if old != nil {
+		old.watcher.Stop()
+	}
+
+	go func() {
+		<-watcher.Done()
+		db.mu.Lock()
+		if db.caches[collName] == c {
+			delete(db.caches, collName)
+		}
+		db.mu.Unlock()
+		if err := watcher.Err(); err != nil {
+			logger.MongoDBLog.Errorln("cache of", collName, "disabled:", err)
+		}
+	}()
+	return nil
+}
+
+/* Stop caching collName and drop its cached results. */
+func (db *DB) DisableCache(collName string) {
+	db.mu.Lock()
+	c := db.caches[collName]
+	delete(db.caches, collName)
+	db.mu.Unlock()
+	if c != nil {
+		c.watcher.Stop()
+	}
+}
+
+/* Return the statistics of the cache of collName, false when it has no cache. */
+func (db *DB) GetCacheStats(collName string) (CacheStats, bool) {
+	db.mu.RLock()
+	c := db.caches[collName]
+	db.mu.RUnlock()
+	if c == nil {
+		return CacheStats{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats, true
+}
+
+/* Return the cache serving reads of collName with ctx, nil when there is none. */
+func (db *DB) cacheFor(ctx context.Context, collName string) *cache {
+	// a transaction must see its own writes and its snapshot.
+	if mongo.SessionFromContext(ctx) != nil {
+		return nil
+	}
+	db.mu.RLock()
+	c := db.caches[collName]
+	db.mu.RUnlock()
+	if c == nil {
+		return nil
+	}
+	// a cache kept by a rebound default instance no longer sees changes once its change stream stopped.
+	select {
+	case <-c.watcher.Done():
+		return nil
+	default:
+		return c
+	}
+}
+
+/* Drop the cached results of collName after a write through db. */
+func (db *DB) invalidateCache(collName string) {
+	db.mu.RLock()
+	c := db.caches[collName]
+	db.mu.RUnlock()
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.stats.Invalidations += uint64(c.lru.Len())
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.byID = map[string]map[string]bool{}
+	c.manyKeys = map[string]bool{}
+}
+
+/* Look up the result of a read of the given kind with filter. On a miss it returns the key and generation to pass
+ * to add with the result read from the database. A nil cache always misses. */
+func (c *cache) lookup(kind string, filter bson.M) (key string, value interface{}, gen uint64, hit bool) {
+	if c == nil {
+		return "", nil, 0, false
+	}
+	key, err := cacheKey(kind, filter)
+	if err != nil {
+		return "", nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			return key, copyValue(entry.value), c.gen, true
+		}
+		c.remove(key)
+	}
+	c.stats.Misses++
+	return key, nil, c.gen, false
+}
+
+/* Store the result of a read, unless the cache was invalidated since lookup returned gen. */
+func (c *cache) add(key string, filter bson.M, value interface{}, gen uint64) {
+	if c == nil || key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if _, ok := c.entries[key]; ok {
+		c.remove(key)
+	}
+
+	entry := &cacheEntry{key: key, filter: copyValue(filter).(bson.M), value: copyValue(value)}
+	if c.opts.TTL > 0 {
+		entry.expires = time.Now().Add(c.opts.TTL)
+	}
+	if doc, ok := value.(map[string]interface{}); ok {
+		entry.id = idKey(doc["_id"])
+		if c.byID[entry.id] == nil {
+			c.byID[entry.id] = map[string]bool{}
+		}
+		c.byID[entry.id][key] = true
+	} else {
+		c.manyKeys[key] = true
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back().Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *cache) remove(key string) {
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, key)
+	delete(c.manyKeys, key)
+	if keys := c.byID[entry.id]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.byID, entry.id)
+		}
+	}
+}
+
+/* Bring the cache up to date with a change of the collection. Any change can alter the results of GetMany, so those
+ * are all dropped; GetOne results are dropped or refreshed when their document changed. */
+func (c *cache) apply(event ChangeEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key := range c.manyKeys {
+		c.remove(key)
+		c.stats.Invalidations++
+	}
+
+	id := idKey(event.DocumentKey["_id"])
+	for key := range c.byID[id] {
+		entry := c.entries[key].Value.(*cacheEntry)
+		changed := event.Type == ChangeUpdate || event.Type == ChangeReplace
+		if changed && c.opts.Refresh && event.Document != nil && stillMatches(entry.filter, event.Document) {
+			entry.value = copyValue(event.Document)
+			if c.opts.TTL > 0 {
+				entry.expires = time.Now().Add(c.opts.TTL)
+			}
+			c.stats.Refreshes++
+			continue
+		}
+		c.remove(key)
+		c.stats.Invalidations++
+	}
+	return nil
+}
+
+/* Report whether doc certainly matches filter. Only equality conditions on scalar fields can be decided, anything
+ * else, and documents of soft delete collections that became tombstones, report false. */
+func stillMatches(filter bson.M, doc map[string]interface{}) bool {
+	if _, deleted := doc[deletedAtField]; deleted {
+		return false
+	}
+	tree := normalize(doc)
+	for field, value := range filter {
+		if strings.HasPrefix(field, "$") {
+			return false
+		}
+		switch value.(type) {
+		case map[string]interface{}, primitive.M, primitive.D, primitive.A, []interface{}:
+			return false
+		}
+		stored, ok := tree, true
+		for _, name := range strings.Split(field, ".") {
+			var m map[string]interface{}
+			if m, ok = stored.(map[string]interface{}); !ok {
+				break
+			}
+			if stored, ok = m[name]; !ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+		switch stored.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+		if !valuesEqual(stored, value) {
+			return false
+		}
+	}
+	return true
+}
+
+/* Build the cache key of a read of the given kind with filter, which does not depend on the order of map keys. */
+func cacheKey(kind string, filter bson.M) (string, error) {
+	key, err := bson.MarshalExtJSON(canonical(filter), true, false)
+	if err != nil {
+		return "", err
+	}
+	return kind + ":" + string(key), nil
+}
+
+/* Convert maps to documents with sorted keys. */
+func canonical(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return canonical(primitive.M(v))
+	case primitive.M:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		doc := make(primitive.D, 0, len(v))
+		for _, key := range keys {
+			doc = append(doc, primitive.E{Key: key, Value: canonical(v[key])})
+		}
+		return doc
+	case primitive.D:
+		doc := make(primitive.D, len(v))
+		for i, e := range v {
+			doc[i] = primitive.E{Key: e.Key, Value: canonical(e.Value)}
+		}
+		return doc
+	case primitive.A:
+		return canonical([]interface{}(v))
+	case []interface{}:
+		result := make(primitive.A, len(v))
+		for i, child := range v {
+			result[i] = canonical(child)
+		}
+		return result
+	}
+	return value
+}
+
+func idKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+/* Deep copy a decoded document or list of documents, keeping the types of nested values, so that callers can
+ * modify what they get without touching the cache. */
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			result[key] = copyValue(child)
+		}
+		return result
+	case primitive.M:
+		if v == nil {
+			return v
+		}
+		result := make(primitive.M, len(v))
+		for key, child := range v {
+			result[key] = copyValue(child)
+		}
+		return result
+	case primitive.D:
+		result := make(primitive.D, len(v))
+		for i, e := range v {
+			result[i] = primitive.E{Key: e.Key, Value: copyValue(e.Value)}
+		}
+		return result
+	case primitive.A:
+		result := make(primitive.A, len(v))
+		for i, child := range v {
+			result[i] = copyValue(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			result[i] = copyValue(child)
+		}
+		return result
+	case []map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		result := make([]map[string]interface{}, len(v))
+		for i, doc := range v {
+			result[i] = copyValue(doc).(map[string]interface{})
+		}
+		return result
+	case primitive.Binary:
+		return primitive.Binary{Subtype: v.Subtype, Data: append([]byte(nil), v.Data...)}
+	}
+	return value
+}
@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/* Collection is a typed view of a collection: documents are decoded straight into T instead of maps.
+ *
+ * The `mongo` struct tag of T declares the indexes created by EnsureIndexes, next to the usual `bson` tag:
+ *
+ *	Name      string    `bson:"name" mongo:"unique"`                  // unique single field index
+ *	Plmn      string    `bson:"plmn" mongo:"index=plmn_imsi"`         // fields sharing a group name form a
+ *	Imsi      string    `bson:"imsi" mongo:"index=plmn_imsi,unique"`  // compound index, in field order
+ *	Age       int       `bson:"age" mongo:"index,desc"`               // descending single field index
+ *	CreatedAt time.Time `bson:"createdAt" mongo:"ttl=24h"`            // TTL index
+ *	ExpiresAt time.Time `bson:"expiresAt" mongo:"ttl=0s"`             // TTL index expiring at the stored date
+ *	Imei      string    `bson:"imei" mongo:"unique,sparse"`           // sparse index, options apply to the group
+ */
+type Collection[T any] struct {
+	db      *DB
+	name    string
+	indexes []Index
+	tagErr  error
+}
+
+/* Return a typed view of the collection collName of db. */
+func NewCollection[T any](db *DB, collName string) *Collection[T] {
+	c := &Collection[T]{db: db, name: collName}
+	c.indexes, c.tagErr = indexesFromTags(reflect.TypeOf((*T)(nil)).Elem())
+	return c
+}
+
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+/* Return the document matching filter, or ErrNotFound. */
+func (c *Collection[T]) Get(ctx context.Context, filter bson.M) (T, error) {
+	const op = "Collection.Get"
+	var result T
+	if err := c.db.check(op); err != nil {
+		return result, err
+	}
+	filter, err := c.db.readFilter(ctx, c.name, filter)
+	if err != nil {
+		return result, wrapError(op, err)
+	}
+	if err := c.db.collection(c.name).FindOne(ctx, filter).Decode(&result); err != nil {
+		return result, wrapError(op, err)
+	}
+	return result, nil
+}
+
+/* Return the documents matching filter. opts may be nil, see QueryOptions. */
+func (c *Collection[T]) GetMany(ctx context.Context, filter bson.M, opts *QueryOptions) ([]T, error) {
+	var results []T
+	err := c.ForEach(ctx, filter, opts, func(doc T) error {
+		results = append(results, doc)
+		return nil
+	})
+	return results, err
+}
+
+/* Call fn for every document matching filter, decoding one document at a time. */
+func (c *Collection[T]) ForEach(ctx context.Context, filter bson.M, opts *QueryOptions, fn func(doc T) error) error {
+	return c.db.ForEach(ctx, c.name, filter, opts, func(it *Iterator) error {
+		var doc T
+		if err := it.Decode(&doc); err != nil {
+			return err
+		}
+		return fn(doc)
+	})
+}
+
+/* Upsert doc on the document matching filter and report whether it existed before. Give the _id field of T the
+ * omitempty option, otherwise the zero _id is written as well. */
+func (c *Collection[T]) Put(ctx context.Context, filter bson.M, doc T) (bool, error) {
+	const op = "Collection.Put"
+	if err := c.db.check(op); err != nil {
+		return false, err
+	}
+	update, err := c.db.putUpdate(ctx, c.name, filter, doc)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	return c.db.putOne(ctx, op, c.db.collection(c.name), filter, update)
+}
+
+/* Apply a JSON merge patch (RFC 7386) to the document matching filter, see RestfulAPIMergePatchWithContext. */
+func (c *Collection[T]) Patch(ctx context.Context, filter bson.M, patch map[string]interface{},
+	opts ...*WriteOptions) error {
+	return c.db.RestfulAPIMergePatchWithContext(ctx, c.name, filter, patch, opts...)
+}
+
+/* Delete the document matching filter and return the number of deleted documents. */
+func (c *Collection[T]) Delete(ctx context.Context, filter bson.M, opts ...*WriteOptions) (int64, error) {
+	return c.db.RestfulAPIDeleteOneWithContext(ctx, c.name, filter, opts...)
+}
+
+/* Delete the document matching filter and return it as it was before the deletion, or ErrNotFound. */
+func (c *Collection[T]) FindAndDelete(ctx context.Context, filter bson.M) (T, error) {
+	const op = "Collection.FindAndDelete"
+	var result T
+	if err := c.db.check(op); err != nil {
+		return result, err
+	}
+	if err := c.db.findAndDeleteDocument(ctx, c.name, filter, &result); err != nil {
+		return result, wrapError(op, err)
+	}
+	return result, nil
+}
+
+/* Reconcile the indexes of the collection with the `mongo` struct tags of T, like DB.EnsureIndexes does with
+ * declared indexes. */
+func (c *Collection[T]) EnsureIndexes(ctx context.Context, opts ...*EnsureIndexesOptions) error {
+	const op = "Collection.EnsureIndexes"
+	if c.tagErr != nil {
+		return newError(op, nil, c.tagErr)
+	}
+	if err := c.db.check(op); err != nil {
+		return err
+	}
+	merged := EnsureIndexesOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			merged = *opt
+		}
+	}
+	return c.db.reconcileIndexes(ctx, op, c.name, c.indexes, merged, &IndexReport{})
+}
+
+/* Build the indexes declared by the `mongo` tags of the struct type t. */
+func indexesFromTags(t reflect.Type) ([]Index, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var order []string
+	groups := map[string]*Index{}
+	var indexes []Index
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("mongo")
+		if !ok || tag == "" || tag == "-" {
+			continue
+		}
+		key := bsonFieldName(field)
+
+		groupName, unique, sparse, descending, expire := "", false, false, false, false
+		var ttl time.Duration
+		for _, part := range strings.Split(tag, ",") {
+			name, value := part, ""
+			if idx := strings.Index(part, "="); idx >= 0 {
+				name, value = part[:idx], part[idx+1:]
+			}
+			switch strings.TrimSpace(name) {
+			case "index":
+				groupName = value
+			case "unique":
+				unique = true
+			case "sparse":
+				sparse = true
+			case "desc":
+				descending = true
+			case "ttl":
+				d, err := time.ParseDuration(value)
+				if err != nil || d < 0 || (d > 0 && d < time.Second) {
+					return nil, fmt.Errorf("field %s: invalid ttl %q", field.Name, value)
+				}
+				ttl, expire = d, true
+			default:
+				return nil, fmt.Errorf("field %s: unknown mongo tag option %q", field.Name, part)
+			}
+		}
+
+		if expire {
+			indexes = append(indexes, Index{Keys: []string{key}, TTL: ttl, Expire: true})
+			continue
+		}
+		if groupName == "" {
+			// fields without a group each get their own index.
+			groupName = "\x00" + key
+		}
+		g, ok := groups[groupName]
+		if !ok {
+			g = &Index{}
+			groups[groupName] = g
+			order = append(order, groupName)
+		}
+		if descending {
+			key = "-" + key
+		}
+		g.Keys = append(g.Keys, key)
+		g.Unique = g.Unique || unique
+		g.Sparse = g.Sparse || sparse
+	}
+
+	for _, name := range order {
+		indexes = append(indexes, *groups[name])
+	}
+	return indexes, nil
+}
+
+/* Return the key the bson codec uses for field: the bson tag name or the lowercased field name. */
+func bsonFieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("bson"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name)
+}
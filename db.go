@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultQueryTimeout   = 30 * time.Second
+	defaultChunkLease     = 10 * time.Minute
+)
+
+/* Options tunes the behaviour of a DB instance. Zero values fall back to the defaults. */
+type Options struct {
+	// ConnectTimeout bounds the initial connection attempt.
+	ConnectTimeout time.Duration
+	// QueryTimeout bounds multi-document reads such as RestfulAPIGetMany when no context is passed.
+	QueryTimeout time.Duration
+	// ChunkLease is how long a chunk taken with GetChunkFromPool stays held once the process stops renewing it,
+	// because it died or lost the database, default 10 minutes. The process renews its chunks until it releases them.
+	ChunkLease time.Duration
+}
+
+/* DB is a handle to one database. Every RestfulAPI*, pool and counter function is available as a method,
+ * so one process can work with several databases at the same time. */
+type DB struct {
+	Client *mongo.Client
+	Name   string
+
+	opts Options
+
+	// mu guards the maps and fields below.
+	mu            sync.RWMutex
+	pools         map[string]poolMetadata
+	softDelete    map[string]softDeleteState
+	caches        map[string]*cache
+	indexes       map[string][]Index
+	ttlIndexes    map[string]time.Duration
+	topologyKnown bool
+	isStandalone  bool
+	// ownChunks holds the chunks taken with GetChunkFromPool, which renewChunks renews while renewing is set.
+	ownChunks map[chunkKey]ownChunk
+	renewing  bool
+}
+
+/* Connect to the given url and return a handle to the database setdbName. */
+func NewDB(setdbName string, url string, opts *Options) (*DB, error) {
+	connectTimeout := defaultConnectTimeout
+	if opts != nil && opts.ConnectTimeout > 0 {
+		connectTimeout = opts.ConnectTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	return NewDBWithContext(ctx, setdbName, url, opts)
+}
+
+/* Like NewDB, but the connection attempt is bounded by ctx instead of Options.ConnectTimeout. */
+func NewDBWithContext(ctx context.Context, setdbName string, url string, opts *Options) (*DB, error) {
+	db := NewDBFromClient(nil, setdbName, opts)
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+	if err != nil {
+		return nil, err
+	}
+	db.Client = client
+	return db, nil
+}
+
+/* Return a handle to the database setdbName that shares an already connected client. */
+func NewDBFromClient(client *mongo.Client, setdbName string, opts *Options) *DB {
+	db := &DB{
+		Client: client,
+		Name:   setdbName,
+
+		pools:      map[string]poolMetadata{},
+		softDelete: map[string]softDeleteState{},
+		caches:     map[string]*cache{},
+		indexes:    map[string][]Index{},
+		ttlIndexes: map[string]time.Duration{},
+
+		ownChunks: map[chunkKey]ownChunk{},
+	}
+	if opts != nil {
+		db.opts = *opts
+	}
+	if db.opts.ConnectTimeout <= 0 {
+		db.opts.ConnectTimeout = defaultConnectTimeout
+	}
+	if db.opts.QueryTimeout <= 0 {
+		db.opts.QueryTimeout = defaultQueryTimeout
+	}
+	if db.opts.ChunkLease <= 0 {
+		db.opts.ChunkLease = defaultChunkLease
+	}
+	return db
+}
+
+func (db *DB) collection(collName string) *mongo.Collection {
+	return db.Client.Database(db.Name).Collection(collName)
+}
+
+// Client and dbName describe the default instance used by the package level functions.
+var Client *mongo.Client = nil
+var dbName string
+var defaultDB *DB
+
+// defaultMu guards defaultDB, and Client and dbName when set through this package.
+var defaultMu sync.Mutex
+
+/* Return the instance used by the package level functions. */
+func DefaultDB() *DB {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	// Client may have been assigned directly by older callers, keep the default instance in sync with it.
+	if defaultDB == nil {
+		defaultDB = NewDBFromClient(Client, dbName, nil)
+	} else if defaultDB.Client != Client || defaultDB.Name != dbName {
+		defaultDB = defaultDB.rebind(Client, dbName)
+	}
+	return defaultDB
+}
+
+/* Make db the instance used by the package level functions. */
+func SetDefaultDB(db *DB) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	setDefaultDB(db)
+}
+
+func setDefaultDB(db *DB) {
+	defaultDB = db
+	Client = db.Client
+	dbName = db.Name
+}
+
+/* Return a handle to the database name over client that keeps the pools and declared indexes registered on db, the
+ * soft delete settings are loaded again. What is tied to the former client or database ends: the caches stop
+ * watching, and the chunks taken with GetChunkFromPool are no longer renewed, so they become free once their lease
+ * expired. */
+func (db *DB) rebind(client *mongo.Client, name string) *DB {
+	rebound := NewDBFromClient(client, name, &db.opts)
+	db.mu.Lock()
+	for poolName, pool := range db.pools {
+		rebound.pools[poolName] = pool
+	}
+	for collName, indexes := range db.indexes {
+		rebound.indexes[collName] = indexes
+	}
+	caches := db.caches
+	db.caches = map[string]*cache{}
+	if len(db.ownChunks) > 0 {
+		logger.MongoDBLog.Warnln("no longer renewing", len(db.ownChunks), "chunks taken from", db.Name)
+	}
+	// renewChunks stops once no chunk is left.
+	db.ownChunks = map[chunkKey]ownChunk{}
+	db.mu.Unlock()
+
+	for _, c := range caches {
+		c.watcher.Stop()
+	}
+	return rebound
+}
+
+func (db *DB) queryTimeout() time.Duration {
+	if db == nil || db.opts.QueryTimeout <= 0 {
+		return defaultQueryTimeout
+	}
+	return db.opts.QueryTimeout
+}
@@ -0,0 +1,679 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+// Copyright 2019 free5GC.org
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+/* Log err unless it only reports a missing document, which the legacy functions signal through their result. */
+func logError(err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		logger.MongoDBLog.Errorln(err)
+	}
+}
+
+func (db *DB) RestfulAPIGetOne(collName string, filter bson.M) map[string]interface{} {
+	result, err := db.RestfulAPIGetOneWithError(collName, filter)
+	logError(err)
+	return result
+}
+
+func (db *DB) RestfulAPIGetOneWithError(collName string, filter bson.M) (map[string]interface{}, error) {
+	return db.RestfulAPIGetOneWithContext(context.Background(), collName, filter)
+}
+
+func (db *DB) RestfulAPIGetOneWithContext(ctx context.Context, collName string,
+	filter bson.M) (map[string]interface{}, error) {
+	const op = "RestfulAPIGetOne"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	c := db.cacheFor(ctx, collName)
+	key, cached, gen, hit := c.lookup("one", filter)
+	if hit {
+		return cached.(map[string]interface{}), nil
+	}
+	collection := db.collection(collName)
+
+	readFilter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	var result map[string]interface{}
+	if err := collection.FindOne(ctx, readFilter).Decode(&result); err != nil {
+		return nil, wrapError(op, err)
+	}
+	stripRevision(result)
+	c.add(key, filter, result, gen)
+
+	return result, nil
+}
+
+func (db *DB) RestfulAPIGetMany(collName string, filter bson.M) []map[string]interface{} {
+	resultArray, err := db.RestfulAPIGetManyWithError(collName, filter)
+	logError(err)
+	return resultArray
+}
+
+func (db *DB) RestfulAPIGetManyWithError(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), db.queryTimeout())
+	defer cancel()
+	return db.RestfulAPIGetManyWithContext(ctx, collName, filter)
+}
+
+func (db *DB) RestfulAPIGetManyWithContext(ctx context.Context, collName string,
+	filter bson.M) ([]map[string]interface{}, error) {
+	const op = "RestfulAPIGetMany"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	c := db.cacheFor(ctx, collName)
+	key, cached, gen, hit := c.lookup("many", filter)
+	if hit {
+		return cached.([]map[string]interface{}), nil
+	}
+	collection := db.collection(collName)
+
+	var resultArray []map[string]interface{}
+
+	readFilter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	cur, err := collection.Find(ctx, readFilter)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var result map[string]interface{}
+		if err := cur.Decode(&result); err != nil {
+			return nil, wrapError(op, err)
+		}
+		stripRevision(result)
+		resultArray = append(resultArray, result)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, wrapError(op, err)
+	}
+	c.add(key, filter, resultArray, gen)
+
+	return resultArray, nil
+}
+
+func (db *DB) GetOneCustomDataStructure(collName string, filter bson.M) (bson.M, error) {
+	return db.GetOneCustomDataStructureWithContext(context.Background(), collName, filter)
+}
+
+func (db *DB) GetOneCustomDataStructureWithContext(ctx context.Context, collName string, filter bson.M) (bson.M,
+	error) {
+	const op = "GetOneCustomDataStructure"
+	if err := db.check(op); err != nil {
+		return bson.M{}, err
+	}
+	collection := db.collection(collName)
+
+	filter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return bson.M{}, wrapError(op, err)
+	}
+	val := collection.FindOne(ctx, filter)
+
+	if val.Err() != nil {
+		logger.MongoDBLog.Println("Error getting student from db: " + val.Err().Error())
+		return bson.M{}, wrapError(op, val.Err())
+	}
+
+	var result bson.M
+	err = val.Decode(&result)
+	stripRevision(result)
+	return result, wrapError(op, err)
+}
+
+func (db *DB) PutOneCustomDataStructure(collName string, filter bson.M, putData interface{}) bool {
+	existed, err := db.PutOneCustomDataStructureWithError(collName, filter, putData)
+	logError(err)
+	return existed
+}
+
+func (db *DB) PutOneCustomDataStructureWithError(collName string, filter bson.M, putData interface{}) (bool, error) {
+	return db.PutOneCustomDataStructureWithContext(context.Background(), collName, filter, putData)
+}
+
+func (db *DB) PutOneCustomDataStructureWithContext(ctx context.Context, collName string, filter bson.M,
+	putData interface{}) (bool, error) {
+	const op = "PutOneCustomDataStructure"
+	if err := db.check(op); err != nil {
+		return false, err
+	}
+	update, err := db.putUpdate(ctx, collName, filter, putData)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	return db.putOne(ctx, op, db.collection(collName), filter, update)
+}
+
+func (db *DB) PutOneWithTimeout(collName string, filter bson.M, putData map[string]interface{}, timeout int32,
+	timeField string) bool {
+	existed, err := db.PutOneWithTimeoutWithError(collName, filter, putData, timeout, timeField)
+	logError(err)
+	return existed
+}
+
+func (db *DB) PutOneWithTimeoutWithError(collName string, filter bson.M, putData map[string]interface{},
+	timeout int32, timeField string) (bool, error) {
+	return db.PutOneWithTimeoutWithContext(context.Background(), collName, filter, putData, timeout, timeField)
+}
+
+func (db *DB) PutOneWithTimeoutWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}, timeout int32, timeField string) (bool, error) {
+	const op = "PutOneWithTimeout"
+	if err := db.check(op); err != nil {
+		return false, err
+	}
+	if err := db.ensureTTLIndex(ctx, op, collName, timeField, time.Duration(timeout)*time.Second); err != nil {
+		return false, err
+	}
+
+	update, err := db.putUpdate(ctx, collName, filter, putData)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	return db.putOne(ctx, op, db.collection(collName), filter, update)
+}
+
+/* Upsert the document matching filter in a single round trip and report whether it existed before. A unique index
+ * on the filter fields (see EnsureUniqueIndex) guarantees that concurrent writers never insert duplicates. In soft
+ * delete collections a tombstone does not count as existing. */
+func (db *DB) putOne(ctx context.Context, op string, collection *mongo.Collection, filter bson.M,
+	update interface{}) (bool, error) {
+	defer db.invalidateCache(collection.Name())
+	for attempt := 0; ; attempt++ {
+		existed, err := db.upsertOne(ctx, collection, filter, update)
+		if err != nil {
+			// A concurrent upsert inserted the same unique key first, retrying updates that document instead.
+			if mongo.IsDuplicateKeyError(err) && attempt == 0 {
+				continue
+			}
+			return false, wrapError(op, err)
+		}
+		return existed, nil
+	}
+}
+
+func (db *DB) upsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M,
+	update interface{}) (bool, error) {
+	softDeleted, err := db.softDeleted(ctx, collection.Name())
+	if err != nil {
+		return false, err
+	}
+	if !softDeleted {
+		result, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount > 0, nil
+	}
+
+	// the document before the update tells a tombstone apart, a live document is preferred when both match.
+	var before bson.M
+	err = collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true).
+		SetSort(bson.M{deletedAtField: 1}).SetProjection(bson.M{deletedAtField: 1})).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return before[deletedAtField] == nil, nil
+}
+
+func (db *DB) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) bool {
+	existed, err := db.RestfulAPIPutOneWithError(collName, filter, putData)
+	logError(err)
+	return existed
+}
+
+func (db *DB) RestfulAPIPutOneWithError(collName string, filter bson.M, putData map[string]interface{},
+	opts ...*WriteOptions) (bool, error) {
+	return db.RestfulAPIPutOneWithContext(context.Background(), collName, filter, putData, opts...)
+}
+
+/* Upsert putData on the document matching filter and report whether it existed before. With opts.IfMatch set the
+ * document is only updated if its entity tag matches, and never inserted. */
+func (db *DB) RestfulAPIPutOneWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}, opts ...*WriteOptions) (bool, error) {
+	const op = "RestfulAPIPutOne"
+	if err := db.check(op); err != nil {
+		return false, err
+	}
+	update, err := db.putUpdate(ctx, collName, filter, putData)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	if ifMatch := writeOptions(opts).IfMatch; ifMatch != "" {
+		readFilter, err := db.readFilter(ctx, collName, filter)
+		if err != nil {
+			return false, wrapError(op, err)
+		}
+		err = db.updateIfMatch(ctx, op, db.collection(collName), readFilter, update, ifMatch)
+		return err == nil, err
+	}
+	return db.putOne(ctx, op, db.collection(collName), filter, update)
+}
+
+func (db *DB) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) bool {
+	existed, err := db.RestfulAPIPutOneNotUpdateWithError(collName, filter, putData)
+	logError(err)
+	return existed
+}
+
+func (db *DB) RestfulAPIPutOneNotUpdateWithError(collName string, filter bson.M,
+	putData map[string]interface{}) (bool, error) {
+	return db.RestfulAPIPutOneNotUpdateWithContext(context.Background(), collName, filter, putData)
+}
+
+func (db *DB) RestfulAPIPutOneNotUpdateWithContext(ctx context.Context, collName string, filter bson.M,
+	putData map[string]interface{}) (bool, error) {
+	const op = "RestfulAPIPutOneNotUpdate"
+	if err := db.check(op); err != nil {
+		return false, err
+	}
+	return db.putIfAbsent(ctx, op, collName, filter, putData)
+}
+
+func (db *DB) RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) bool {
+	result, err := db.RestfulAPIPutManyWithError(collName, filterArray, putDataArray)
+	logError(err)
+	// like RestfulAPIPutOne, report whether the last document existed before.
+	if result == nil || len(result.Items) == 0 {
+		return false
+	}
+	return result.Items[len(result.Items)-1].Status == BulkItemUpdated
+}
+
+func (db *DB) RestfulAPIPutManyWithError(collName string, filterArray []bson.M,
+	putDataArray []map[string]interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	return db.RestfulAPIPutManyWithContext(context.Background(), collName, filterArray, putDataArray, opts...)
+}
+
+/* Upsert putDataArray[i] on the document matching filterArray[i], all in one bulk operation. */
+func (db *DB) RestfulAPIPutManyWithContext(ctx context.Context, collName string, filterArray []bson.M,
+	putDataArray []map[string]interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	const op = "RestfulAPIPutMany"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	if len(filterArray) < len(putDataArray) {
+		return nil, newError(op, nil, errors.New("fewer filters than documents"))
+	}
+
+	models := make([]mongo.WriteModel, 0, len(putDataArray))
+	for i, putData := range putDataArray {
+		update, err := db.putUpdate(ctx, collName, filterArray[i], putData)
+		if err != nil {
+			return nil, wrapError(op, err)
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filterArray[i]).SetUpdate(update).SetUpsert(true))
+	}
+	return db.bulkWrite(ctx, op, db.collection(collName), models, bulkOptions(opts))
+}
+
+func (db *DB) RestfulAPIDeleteOne(collName string, filter bson.M) {
+	_, err := db.RestfulAPIDeleteOneWithError(collName, filter)
+	logError(err)
+}
+
+func (db *DB) RestfulAPIDeleteOneWithError(collName string, filter bson.M, opts ...*WriteOptions) (int64, error) {
+	return db.RestfulAPIDeleteOneWithContext(context.Background(), collName, filter, opts...)
+}
+
+/* Delete the document matching filter and return the number of deleted documents, 0 when none matched. With
+ * opts.IfMatch set it is only deleted if its entity tag matches, and ErrPreconditionFailed is returned otherwise. */
+func (db *DB) RestfulAPIDeleteOneWithContext(ctx context.Context, collName string, filter bson.M,
+	opts ...*WriteOptions) (int64, error) {
+	const op = "RestfulAPIDeleteOne"
+	if err := db.check(op); err != nil {
+		return 0, err
+	}
+
+	ifMatch := writeOptions(opts).IfMatch
+	if ifMatch != "" {
+		var ok bool
+		if filter, ok = ifMatchFilter(filter, ifMatch); !ok {
+			return 0, newError(op, ErrPreconditionFailed, nil)
+		}
+	}
+	deleted, err := db.deleteDocuments(ctx, collName, filter, false)
+	if err != nil {
+		return 0, wrapError(op, err)
+	}
+	if ifMatch != "" && deleted == 0 {
+		return 0, newError(op, ErrPreconditionFailed, nil)
+	}
+	return deleted, nil
+}
+
+func (db *DB) RestfulAPIDeleteMany(collName string, filter bson.M) {
+	_, err := db.RestfulAPIDeleteManyWithError(collName, filter)
+	logError(err)
+}
+
+func (db *DB) RestfulAPIDeleteManyWithError(collName string, filter bson.M) (int64, error) {
+	return db.RestfulAPIDeleteManyWithContext(context.Background(), collName, filter)
+}
+
+/* Delete the documents matching filter and return how many were deleted. */
+func (db *DB) RestfulAPIDeleteManyWithContext(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	const op = "RestfulAPIDeleteMany"
+	if err := db.check(op); err != nil {
+		return 0, err
+	}
+
+	deleted, err := db.deleteDocuments(ctx, collName, filter, true)
+	if err != nil {
+		return 0, wrapError(op, err)
+	}
+	return deleted, nil
+}
+
+/* Delete the document matching filter and return it as it was before the deletion, or ErrNotFound. With
+ * opts.IfMatch set it is only deleted if its entity tag matches, and ErrPreconditionFailed is returned otherwise. */
+func (db *DB) RestfulAPIFindOneAndDelete(ctx context.Context, collName string, filter bson.M,
+	opts ...*WriteOptions) (map[string]interface{}, error) {
+	const op = "RestfulAPIFindOneAndDelete"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+
+	ifMatch := writeOptions(opts).IfMatch
+	if ifMatch != "" {
+		var ok bool
+		if filter, ok = ifMatchFilter(filter, ifMatch); !ok {
+			return nil, newError(op, ErrPreconditionFailed, nil)
+		}
+	}
+	var result map[string]interface{}
+	if err := db.findAndDeleteDocument(ctx, collName, filter, &result); err != nil {
+		if ifMatch != "" && errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, newError(op, ErrPreconditionFailed, err)
+		}
+		return nil, wrapError(op, err)
+	}
+	stripRevision(result)
+	return result, nil
+}
+
+/* Delete the documents matching filter and return them as they were before the deletion. Each document is removed
+ * and returned atomically, but the call as a whole is not: a document deleted concurrently by someone else is
+ * neither counted nor returned. */
+func (db *DB) RestfulAPIFindManyAndDelete(ctx context.Context, collName string,
+	filter bson.M) ([]map[string]interface{}, error) {
+	const op = "RestfulAPIFindManyAndDelete"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	collection := db.collection(collName)
+
+	readFilter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	cur, err := collection.Find(ctx, readFilter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	var ids []struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err := cur.All(ctx, &ids); err != nil {
+		return nil, wrapError(op, err)
+	}
+
+	var resultArray []map[string]interface{}
+	for _, id := range ids {
+		// the filter is repeated so that a document changed since the query is only removed if it still matches.
+		var result map[string]interface{}
+		err := db.findAndDeleteDocument(ctx, collName, bson.M{"$and": bson.A{filter, bson.M{"_id": id.ID}}}, &result)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return resultArray, wrapError(op, err)
+		}
+		stripRevision(result)
+		resultArray = append(resultArray, result)
+	}
+	return resultArray, nil
+}
+
+func (db *DB) RestfulAPIMergePatch(collName string, filter bson.M, patchData map[string]interface{}) bool {
+	err := db.RestfulAPIMergePatchWithError(collName, filter, patchData)
+	logError(err)
+	return err == nil
+}
+
+func (db *DB) RestfulAPIMergePatchWithError(collName string, filter bson.M, patchData map[string]interface{},
+	opts ...*WriteOptions) error {
+	return db.RestfulAPIMergePatchWithContext(context.Background(), collName, filter, patchData, opts...)
+}
+
+/* Apply a JSON merge patch (RFC 7386) to the document matching filter, members set to null are removed from the
+ * stored document. A write by someone else between reading and writing the document fails with ErrWriteConflict
+ * unless opts allow retries. */
+func (db *DB) RestfulAPIMergePatchWithContext(ctx context.Context, collName string, filter bson.M,
+	patchData map[string]interface{}, opts ...*WriteOptions) error {
+	const op = "RestfulAPIMergePatch"
+	if err := db.check(op); err != nil {
+		return err
+	}
+
+	return db.patchDocument(ctx, op, collName, filter, writeOptions(opts),
+		func(originalData map[string]interface{}, raw bson.Raw) (bson.M, bson.M, error) {
+			modified := applyMergePatch(deepCopy(originalData), normalize(patchData))
+			update, err := diffUpdate(originalData, modified.(map[string]interface{}), raw)
+			if err != nil {
+				return nil, nil, newError(op, ErrInvalidPatch, err)
+			}
+			return update, nil, nil
+		})
+}
+
+func (db *DB) RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) bool {
+	err := db.RestfulAPIJSONPatchWithError(collName, filter, patchJSON)
+	logError(err)
+	return err == nil
+}
+
+func (db *DB) RestfulAPIJSONPatchWithError(collName string, filter bson.M, patchJSON []byte,
+	opts ...*WriteOptions) error {
+	return db.RestfulAPIJSONPatchWithContext(context.Background(), collName, filter, patchJSON, opts...)
+}
+
+/* Apply a JSON patch (RFC 6902) to the document matching filter, paths removed by the patch are removed from the
+ * stored document. A write by someone else between reading and writing the document fails with ErrWriteConflict
+ * unless opts allow retries. Test operations become conditions of the update, so the patch is only written while
+ * the tested values still hold in the database; otherwise it fails with ErrPreconditionFailed. */
+func (db *DB) RestfulAPIJSONPatchWithContext(ctx context.Context, collName string, filter bson.M,
+	patchJSON []byte, opts ...*WriteOptions) error {
+	const op = "RestfulAPIJSONPatch"
+	if err := db.check(op); err != nil {
+		return err
+	}
+
+	patch, err := decodeJSONPatch(patchJSON)
+	if err != nil {
+		return newError(op, ErrInvalidPatch, err)
+	}
+
+	return db.patchDocument(ctx, op, collName, filter, writeOptions(opts),
+		func(originalData map[string]interface{}, raw bson.Raw) (bson.M, bson.M, error) {
+			modified, err := applyJSONPatch(deepCopy(originalData), patch)
+			if err != nil {
+				return nil, nil, patchError(op, err)
+			}
+			modifiedData, ok := modified.(map[string]interface{})
+			if !ok {
+				return nil, nil, newError(op, ErrPatchConflict, errors.New("patch does not leave a document"))
+			}
+			update, err := diffUpdate(originalData, modifiedData, raw)
+			if err != nil {
+				return nil, nil, newError(op, ErrInvalidPatch, err)
+			}
+			return update, testConditions(patch, nil, raw), nil
+		})
+}
+
+func (db *DB) RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) bool {
+	err := db.RestfulAPIJSONPatchExtendWithError(collName, filter, patchJSON, dataName)
+	logError(err)
+	return err == nil
+}
+
+func (db *DB) RestfulAPIJSONPatchExtendWithError(collName string, filter bson.M, patchJSON []byte,
+	dataName string, opts ...*WriteOptions) error {
+	return db.RestfulAPIJSONPatchExtendWithContext(context.Background(), collName, filter, patchJSON, dataName,
+		opts...)
+}
+
+/* Apply a JSON patch (RFC 6902) to the subtree at dataName of the document matching filter, and write back only
+ * that subtree. dataName is a JSON pointer such as "/smData/0/dnnConfigurations" or a dotted path such as
+ * "smData.0.dnnConfigurations", and may point at a document, an array or a scalar. */
+func (db *DB) RestfulAPIJSONPatchExtendWithContext(ctx context.Context, collName string, filter bson.M,
+	patchJSON []byte, dataName string, opts ...*WriteOptions) error {
+	const op = "RestfulAPIJSONPatchExtend"
+	if err := db.check(op); err != nil {
+		return err
+	}
+
+	path, err := parseDataPath(dataName)
+	if err != nil {
+		return newError(op, ErrInvalidPatch, err)
+	}
+	field, err := dottedPath(path)
+	if err != nil {
+		return newError(op, ErrInvalidPatch, err)
+	}
+	patch, err := decodeJSONPatch(patchJSON)
+	if err != nil {
+		return newError(op, ErrInvalidPatch, err)
+	}
+
+	return db.patchDocument(ctx, op, collName, filter, writeOptions(opts),
+		func(originalDataCover map[string]interface{}, raw bson.Raw) (bson.M, bson.M, error) {
+			originalData, err := patchGet(originalDataCover, path)
+			if err != nil {
+				return nil, nil, newError(op, ErrPatchConflict, err)
+			}
+			modifiedData, err := applyJSONPatch(deepCopy(originalData), patch)
+			if err != nil {
+				return nil, nil, patchError(op, err)
+			}
+			if reflect.DeepEqual(originalData, modifiedData) {
+				return nil, nil, nil
+			}
+			stored, _ := raw.LookupErr(path...)
+			return bson.M{"$set": bson.M{field: ordered(modifiedData, stored)}}, testConditions(patch, path, raw), nil
+		})
+}
+
+/* Classify an error of applyJSONPatch. */
+func patchError(op string, err error) error {
+	if errors.Is(err, errTestFailed) {
+		return newError(op, ErrPreconditionFailed, err)
+	}
+	return newError(op, ErrPatchConflict, err)
+}
+
+func (db *DB) RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) bool {
+	existed, err := db.RestfulAPIPostWithError(collName, filter, postData)
+	logError(err)
+	return existed
+}
+
+func (db *DB) RestfulAPIPostWithError(collName string, filter bson.M, postData map[string]interface{}) (bool,
+	error) {
+	return db.RestfulAPIPostWithContext(context.Background(), collName, filter, postData)
+}
+
+func (db *DB) RestfulAPIPostWithContext(ctx context.Context, collName string, filter bson.M,
+	postData map[string]interface{}) (bool, error) {
+	const op = "RestfulAPIPost"
+	if err := db.check(op); err != nil {
+		return false, err
+	}
+	update, err := db.putUpdate(ctx, collName, filter, postData)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	return db.putOne(ctx, op, db.collection(collName), filter, update)
+}
+
+func (db *DB) RestfulAPIPostMany(collName string, filter bson.M, postDataArray []interface{}) bool {
+	_, err := db.RestfulAPIPostManyWithError(collName, filter, postDataArray)
+	logError(err)
+	return false
+}
+
+func (db *DB) RestfulAPIPostManyWithError(collName string, filter bson.M, postDataArray []interface{},
+	opts ...*BulkOptions) (*BulkResult, error) {
+	return db.RestfulAPIPostManyWithContext(context.Background(), collName, filter, postDataArray, opts...)
+}
+
+/* Insert every document of postDataArray in one bulk operation, filter is not used. A document that carries its
+ * own _id is merged into the document with that _id, or inserted when there is none. Any other document that collides
+ * with an existing one on a unique index fails with ErrDuplicateKey in its item of the result. */
+func (db *DB) RestfulAPIPostManyWithContext(ctx context.Context, collName string, filter bson.M,
+	postDataArray []interface{}, opts ...*BulkOptions) (*BulkResult, error) {
+	const op = "RestfulAPIPostMany"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+
+	models := make([]mongo.WriteModel, 0, len(postDataArray))
+	for _, postData := range postDataArray {
+		id, ok, err := documentID(postData)
+		if err != nil {
+			return nil, newError(op, nil, err)
+		}
+		if !ok {
+			models = append(models, mongo.NewInsertOneModel().SetDocument(postData))
+			continue
+		}
+		key := bson.M{"_id": id}
+		update, err := db.putUpdate(ctx, collName, key, postData)
+		if err != nil {
+			return nil, wrapError(op, err)
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(key).SetUpdate(update).SetUpsert(true))
+	}
+	return db.bulkWrite(ctx, op, db.collection(collName), models, bulkOptions(opts))
+}
+
+/* Return the _id of doc, and whether it has one. */
+func documentID(doc interface{}) (interface{}, bool, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, false, err
+	}
+	id, ok := fields["_id"]
+	return id, ok, nil
+}
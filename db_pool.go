@@ -0,0 +1,619 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+// uniqueIdentityCollection and uniqueIdentityID locate the counter of GetUniqueIdentity.
+const (
+	uniqueIdentityCollection = "counter"
+	uniqueIdentityID         = "uniqueIdentity"
+)
+
+/* Get unique identity from counter collection. */
+func (db *DB) GetUniqueIdentity() int32 {
+	id, err := db.GetUniqueIdentityWithError()
+	logError(err)
+	return id
+}
+
+func (db *DB) GetUniqueIdentityWithError() (int32, error) {
+	return db.GetUniqueIdentityWithContext(context.Background())
+}
+
+func (db *DB) GetUniqueIdentityWithContext(ctx context.Context) (int32, error) {
+	const op = "GetUniqueIdentity"
+	if err := db.check(op); err != nil {
+		return -1, err
+	}
+	counterCollection := db.collection(uniqueIdentityCollection)
+
+	counterFilter := bson.M{}
+	counterFilter["_id"] = uniqueIdentityID
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return -1, wrapError(op, err)
+		}
+		count := counterCollection.FindOneAndUpdate(ctx, counterFilter, bson.M{"$inc": bson.M{"count": 1}})
+
+		if count.Err() != nil {
+			if count.Err() != mongo.ErrNoDocuments {
+				return -1, wrapError(op, count.Err())
+			}
+			counterData := bson.M{}
+			counterData["count"] = 1
+			counterData["_id"] = uniqueIdentityID
+			// another instance may have created the counter first, which is fine.
+			if _, err := counterCollection.InsertOne(ctx, counterData); err != nil &&
+				!mongo.IsDuplicateKeyError(err) {
+				return -1, wrapError(op, err)
+			}
+
+			continue
+		} else {
+			data := bson.M{}
+			if err := count.Decode(&data); err != nil {
+				return -1, wrapError(op, err)
+			}
+			decodedCount, ok := data["count"].(int32)
+			if !ok {
+				return -1, newError(op, nil, errors.New("counter is not an int32"))
+			}
+			return decodedCount, nil
+		}
+	}
+}
+
+/* Get a unique id within a given range. */
+func (db *DB) GetUniqueIdentityWithinRange(min int32, max int32) int32 {
+	id, err := db.GetUniqueIdentityWithinRangeWithError(min, max)
+	if err != nil {
+		logger.MongoDBLog.Println(err)
+	}
+	return id
+}
+
+func (db *DB) GetUniqueIdentityWithinRangeWithError(min int32, max int32) (int32, error) {
+	return db.GetUniqueIdentityWithinRangeWithContext(context.Background(), min, max)
+}
+
+func (db *DB) GetUniqueIdentityWithinRangeWithContext(ctx context.Context, min int32, max int32) (int32, error) {
+	const op = "GetUniqueIdentityWithinRange"
+	if err := db.check(op); err != nil {
+		return -1, err
+	}
+	rangeCollection := db.collection("range")
+
+	rangeFilter := bson.M{}
+	rangeFilter["_id"] = "uniqueIdentity"
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return -1, wrapError(op, err)
+		}
+		count := rangeCollection.FindOneAndUpdate(ctx, rangeFilter, bson.M{"$inc": bson.M{"count": 1}})
+
+		if count.Err() != nil {
+			if count.Err() != mongo.ErrNoDocuments {
+				return -1, wrapError(op, count.Err())
+			}
+			counterData := bson.M{}
+			counterData["count"] = min
+			counterData["_id"] = "uniqueIdentity"
+			if _, err := rangeCollection.InsertOne(ctx, counterData); err != nil &&
+				!mongo.IsDuplicateKeyError(err) {
+				return -1, wrapError(op, err)
+			}
+
+			continue
+		} else {
+			data := bson.M{}
+			if err := count.Decode(&data); err != nil {
+				return -1, wrapError(op, err)
+			}
+			decodedCount, ok := data["count"].(int32)
+			if !ok {
+				return -1, newError(op, nil, errors.New("counter is not an int32"))
+			}
+
+			if decodedCount >= max || decodedCount <= min {
+				return -1, newError(op, ErrOutOfRange, nil)
+			}
+			return decodedCount, nil
+		}
+	}
+}
+
+/* Initialize pool of ids with max and min values and chunk size and amount of retries to get a chunk. */
+func (db *DB) InitializeChunkPool(poolName string, min int, max int, retries int, chunkSize int) {
+	logError(db.InitializeChunkPoolWithError(poolName, min, max, retries, chunkSize))
+}
+
+func (db *DB) InitializeChunkPoolWithError(poolName string, min int, max int, retries int, chunkSize int) error {
+	return db.InitializeChunkPoolWithContext(context.Background(), poolName, min, max, retries, chunkSize)
+}
+
+/* Define the chunk pool poolName, or check that it is defined with the same range and chunk size. */
+func (db *DB) InitializeChunkPoolWithContext(ctx context.Context, poolName string, min int, max int, retries int,
+	chunkSize int) error {
+	const op = "InitializeChunkPool"
+	logger.MongoDBLog.Println("ENTERING InitializeChunkPool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	if min >= max || retries <= 0 || chunkSize <= 0 || chunkSize > max-min {
+		return newError(op, ErrInvalidPool, nil)
+	}
+	pool := poolMetadata{
+		Name:      poolName,
+		Strategy:  StrategyChunk,
+		Min:       min,
+		Max:       max,
+		ChunkSize: chunkSize,
+		Retries:   retries,
+	}
+	if err := db.registerPool(ctx, op, pool); err != nil {
+		return err
+	}
+	logger.MongoDBLog.Println("Pool: ", pool)
+	return nil
+}
+
+/* Get id by inserting into collection. If insert succeeds, that id is available. Else, it isn't available so retry.
+ * The chunk is leased for Options.ChunkLease and renewed in the background until ReleaseChunkToPool, so the chunks
+ * of a process that died can be taken over. */
+func (db *DB) GetChunkFromPool(poolName string) (int32, int32, int32, error) {
+	return db.GetChunkFromPoolWithContext(context.Background(), poolName)
+}
+
+func (db *DB) GetChunkFromPoolWithContext(ctx context.Context, poolName string) (int32, int32, int32, error) {
+	const op = "GetChunkFromPool"
+	logger.MongoDBLog.Println("ENTERING GetChunkFromPool")
+	if err := db.check(op); err != nil {
+		return -1, -1, -1, err
+	}
+
+	pool, err := db.pool(ctx, op, poolName, StrategyChunk)
+	if err != nil {
+		return -1, -1, -1, err
+	}
+
+	min := pool.Min
+	max := pool.Max
+	retries := pool.Retries
+	chunkSize := pool.ChunkSize
+	totalChunks := int((max - min) / chunkSize)
+
+	i := 0
+	for i < retries {
+		if err := ctx.Err(); err != nil {
+			return -1, -1, -1, wrapError(op, err)
+		}
+		random := rand.Intn(totalChunks)
+		lower := min + (random * chunkSize)
+		upper := lower + chunkSize
+
+		claimed, err := db.claimOwnChunk(ctx, poolName, random, lower, upper)
+		if err != nil {
+			return -1, -1, -1, wrapError(op, err)
+		}
+		if claimed {
+			logger.MongoDBLog.Println("Assigned chunk # ", random, " with range ", lower, " - ", upper)
+			return int32(random), int32(lower), int32(upper), nil
+		}
+		logger.MongoDBLog.Println("Chunk", random, " has already been assigned. ", retries-i-1, " retries left.")
+		i++
+	}
+
+	// the random picks collided, look for the free chunks in order.
+	logger.MongoDBLog.Println("No chunk found after retries, scanning", poolName)
+	for chunk := 0; ; chunk++ {
+		chunk, err = db.firstFree(ctx, poolName, chunk, totalChunks, heldChunks())
+		if err != nil {
+			return -1, -1, -1, wrapError(op, err)
+		}
+		if chunk == totalChunks {
+			err := fmt.Errorf("all %d chunks of %s are assigned", totalChunks, poolName)
+			return -1, -1, -1, newError(op, ErrPoolExhausted, err)
+		}
+		lower := min + (chunk * chunkSize)
+		upper := lower + chunkSize
+		claimed, err := db.claimOwnChunk(ctx, poolName, chunk, lower, upper)
+		if err != nil {
+			return -1, -1, -1, wrapError(op, err)
+		}
+		if claimed {
+			logger.MongoDBLog.Println("Assigned chunk # ", chunk, " with range ", lower, " - ", upper)
+			return int32(chunk), int32(lower), int32(upper), nil
+		}
+	}
+}
+
+/* Make owner the owner of the chunk with the given number until expiresAt and return the fencing token of the
+ * handoff. A chunk can be claimed when it was never claimed, was released or its lease expired; claimed reports
+ * false when another owner holds it. Chunk documents are kept once created so that their token keeps increasing
+ * with every handoff. */
+func (db *DB) claimChunk(ctx context.Context, poolName string, chunk int, lower int, upper int, owner string,
+	expiresAt time.Time) (token int64, claimed bool, err error) {
+	update := bson.M{
+		"$set": bson.M{"lower": lower, "upper": upper, "owner": owner, "expiresAt": expiresAt},
+		"$inc": bson.M{"token": 1},
+	}
+
+	// a chunk that is held does not match the filter, so the upsert fails on its _id.
+	var doc struct {
+		Token int64 `bson:"token"`
+	}
+	err = db.collection(poolName).FindOneAndUpdate(ctx, bson.M{"_id": chunk, "expiresAt": bson.M{"$lte": time.Now()}},
+		update, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return doc.Token, true, nil
+}
+
+/* Filter the chunks that are currently held. Chunks claimed before chunks had leases have no expiry, see
+ * MigrateChunkPool. */
+func heldChunks() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+	}}
+}
+
+/* Mark the chunk matching filter as free, reporting whether it matched. */
+func (db *DB) releaseChunk(ctx context.Context, poolName string, filter bson.M) (bool, error) {
+	result, err := db.collection(poolName).UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"expiresAt": time.Unix(0, 0)}, "$unset": bson.M{"owner": ""}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+/* Release the provided id to the provided pool. */
+func (db *DB) ReleaseChunkToPool(poolName string, id int32) {
+	logError(db.ReleaseChunkToPoolWithError(poolName, id))
+}
+
+func (db *DB) ReleaseChunkToPoolWithError(poolName string, id int32) error {
+	return db.ReleaseChunkToPoolWithContext(context.Background(), poolName, id)
+}
+
+/* Like ReleaseChunkToPool. Only the chunks db took with GetChunkFromPool, and still holds, are released; a chunk held
+ * by anyone else fails with ErrNotOwner, and a free chunk is left as is. */
+func (db *DB) ReleaseChunkToPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	const op = "ReleaseChunkToPool"
+	logger.MongoDBLog.Println("ENTERING ReleaseChunkToPool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	// only the holder of the current fencing token of the chunk may release it.
+	released, err := db.releaseOwnChunk(ctx, poolName, int(id))
+	if err != nil || released {
+		return wrapError(op, err)
+	}
+
+	// releasing a free chunk has no effect, but a chunk of another owner is left to it.
+	var chunk struct {
+		Owner string `bson:"owner"`
+	}
+	err = db.collection(poolName).FindOne(ctx, bson.M{"$and": bson.A{bson.M{"_id": id}, heldChunks()}}).Decode(&chunk)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return wrapError(op, err)
+	}
+	return newError(op, ErrNotOwner, fmt.Errorf("chunk %d is held by %q", id, chunk.Owner))
+}
+
+/* Initialize pool of ids with max and min values. */
+func (db *DB) InitializeInsertPool(poolName string, min int, max int, retries int) {
+	logError(db.InitializeInsertPoolWithError(poolName, min, max, retries))
+}
+
+func (db *DB) InitializeInsertPoolWithError(poolName string, min int, max int, retries int) error {
+	return db.InitializeInsertPoolWithContext(context.Background(), poolName, min, max, retries)
+}
+
+/* Define the insert pool poolName, or check that it is defined with the same range. */
+func (db *DB) InitializeInsertPoolWithContext(ctx context.Context, poolName string, min int, max int,
+	retries int) error {
+	const op = "InitializeInsertPool"
+	logger.MongoDBLog.Println("ENTERING InitializeInsertPool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	if min >= max || retries <= 0 {
+		return newError(op, ErrInvalidPool, nil)
+	}
+	pool := poolMetadata{
+		Name:     poolName,
+		Strategy: StrategyInsert,
+		Min:      min,
+		Max:      max,
+		Retries:  retries,
+	}
+	if err := db.registerPool(ctx, op, pool); err != nil {
+		return err
+	}
+	logger.MongoDBLog.Println("Pool: ", pool)
+	return nil
+}
+
+/* Get id by inserting into collection. If insert succeeds, that id is available. Else, it isn't available so retry. */
+func (db *DB) GetIDFromInsertPool(poolName string) (int32, error) {
+	return db.GetIDFromInsertPoolWithContext(context.Background(), poolName)
+}
+
+func (db *DB) GetIDFromInsertPoolWithContext(ctx context.Context, poolName string) (int32, error) {
+	const op = "GetIDFromInsertPool"
+	logger.MongoDBLog.Println("ENTERING GetIDFromInsertPool")
+	if err := db.check(op); err != nil {
+		return -1, err
+	}
+
+	pool, err := db.pool(ctx, op, poolName, StrategyInsert)
+	if err != nil {
+		return -1, err
+	}
+
+	min := pool.Min
+	max := pool.Max
+	retries := pool.Retries
+	i := 0
+	for i < retries {
+		if err := ctx.Err(); err != nil {
+			return -1, wrapError(op, err)
+		}
+		random := rand.Intn(max-min) + min // returns random int in [0, max-min-1] + min
+
+		claimed, err := db.claimID(ctx, poolName, random)
+		if err != nil {
+			return -1, wrapError(op, err)
+		}
+		if claimed {
+			logger.MongoDBLog.Println("Assigned id: ", random)
+			return int32(random), nil
+		}
+		logger.MongoDBLog.Println("This id has already been assigned. ")
+		i++
+	}
+
+	// the random picks collided, look for the free ids in order.
+	logger.MongoDBLog.Println("No id found after retries, scanning", poolName)
+	for id := min; ; id++ {
+		id, err = db.firstFree(ctx, poolName, id, max, nil)
+		if err != nil {
+			return -1, wrapError(op, err)
+		}
+		if id == max {
+			return -1, newError(op, ErrPoolExhausted, fmt.Errorf("all ids of %s are assigned", poolName))
+		}
+		claimed, err := db.claimID(ctx, poolName, id)
+		if err != nil {
+			return -1, wrapError(op, err)
+		}
+		if claimed {
+			logger.MongoDBLog.Println("Assigned id: ", id)
+			return int32(id), nil
+		}
+	}
+}
+
+/* Insert the document of id into the insert pool, reporting false when it already exists. */
+func (db *DB) claimID(ctx context.Context, poolName string, id int) (bool, error) {
+	// Create an instance of an options and set the desired options
+	upsert := true
+	opt := options.FindOneAndUpdateOptions{
+		Upsert: &upsert,
+	}
+	result := db.collection(poolName).FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"_id": id}},
+		&opt)
+
+	// no document before the update means that the upsert inserted it.
+	if result.Err() == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	return false, result.Err()
+}
+
+/* Return the lowest id in [start, end) without a document in the pool collection matching held, end when all of
+ * them have one. The documents are read in the order of the _id index, so the cost grows with the number of
+ * allocated ids below the result. */
+func (db *DB) firstFree(ctx context.Context, poolName string, start int, end int, held bson.M) (int, error) {
+	filter := bson.M{"_id": bson.M{"$gte": start, "$lt": end}}
+	for key, value := range held {
+		filter[key] = value
+	}
+	cursor, err := db.collection(poolName).Find(ctx, filter,
+		options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"_id": 1}).SetBatchSize(1000))
+	if err != nil {
+		return end, err
+	}
+	defer cursor.Close(ctx)
+
+	next := start
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID int `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return end, err
+		}
+		if doc.ID > next {
+			return next, nil
+		}
+		next = doc.ID + 1
+	}
+	if err := cursor.Err(); err != nil {
+		return end, err
+	}
+	return next, nil
+}
+
+/* Release the provided id to the provided pool. */
+func (db *DB) ReleaseIDToInsertPool(poolName string, id int32) {
+	logError(db.ReleaseIDToInsertPoolWithError(poolName, id))
+}
+
+func (db *DB) ReleaseIDToInsertPoolWithError(poolName string, id int32) error {
+	return db.ReleaseIDToInsertPoolWithContext(context.Background(), poolName, id)
+}
+
+func (db *DB) ReleaseIDToInsertPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	const op = "ReleaseIDToInsertPool"
+	logger.MongoDBLog.Println("ENTERING ReleaseIDToInsertPool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	poolCollection := db.collection(poolName)
+
+	_, err := poolCollection.DeleteOne(ctx, bson.M{"_id": id})
+	return wrapError(op, err)
+}
+
+/* Initialize pool of ids with max and min values. */
+func (db *DB) InitializePool(poolName string, min int32, max int32) {
+	logError(db.InitializePoolWithError(poolName, min, max))
+}
+
+func (db *DB) InitializePoolWithError(poolName string, min int32, max int32) error {
+	return db.InitializePoolWithContext(context.Background(), poolName, min, max)
+}
+
+func (db *DB) InitializePoolWithContext(ctx context.Context, poolName string, min int32, max int32) error {
+	const op = "InitializePool"
+	logger.MongoDBLog.Println("ENTERING InitializePool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	if min >= max {
+		return newError(op, ErrInvalidPool, nil)
+	}
+	pool := poolMetadata{Name: poolName, Strategy: StrategyPool, Min: int(min), Max: int(max)}
+	if err := db.registerPool(ctx, op, pool); err != nil {
+		return err
+	}
+	poolCollection := db.collection(poolName)
+	names, err := db.Client.Database(db.Name).ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return wrapError(op, err)
+	}
+
+	logger.MongoDBLog.Println(names)
+
+	exists := false
+	for _, name := range names {
+		if name == poolName {
+			logger.MongoDBLog.Println("The collection exists!")
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		logger.MongoDBLog.Println("Creating collection")
+
+		array := []int32{}
+		for i := min; i < max; i++ {
+			array = append(array, i)
+		}
+		poolData := bson.M{}
+		poolData["ids"] = array
+		poolData["_id"] = poolName
+
+		// collection is created when inserting document.
+		// "If a collection does not exist, MongoDB creates the collection when you first store data for that collection."
+		// Another instance may have created it in the meantime, which is fine.
+		if _, err := poolCollection.InsertOne(ctx, poolData); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return wrapError(op, err)
+		}
+	}
+	return nil
+}
+
+/* For example IP addresses need to be assigned and then returned to be used again. */
+func (db *DB) GetIDFromPool(poolName string) (int32, error) {
+	return db.GetIDFromPoolWithContext(context.Background(), poolName)
+}
+
+func (db *DB) GetIDFromPoolWithContext(ctx context.Context, poolName string) (int32, error) {
+	const op = "GetIDFromPool"
+	logger.MongoDBLog.Println("ENTERING GetIDFromPool")
+	if err := db.check(op); err != nil {
+		return -1, err
+	}
+	poolCollection := db.collection(poolName)
+
+	result := bson.M{}
+	err := poolCollection.FindOneAndUpdate(ctx, bson.M{"_id": poolName},
+		bson.M{"$pop": bson.M{"ids": 1}}).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return -1, newError(op, ErrPoolNotFound, err)
+		}
+		return -1, wrapError(op, err)
+	}
+
+	var array []int32
+	interfaces, _ := result["ids"].(primitive.A)
+	for _, s := range interfaces {
+		if id, ok := s.(int32); ok {
+			array = append(array, id)
+		}
+	}
+
+	logger.MongoDBLog.Println("Array of ids: ", array)
+	if len(array) > 0 {
+		res := array[len(array)-1]
+		return res, nil
+	} else {
+		err := errors.New("There are no available ids.")
+		logger.MongoDBLog.Println(err)
+		return -1, newError(op, ErrPoolExhausted, err)
+	}
+}
+
+/* Release the provided id to the provided pool. */
+func (db *DB) ReleaseIDToPool(poolName string, id int32) {
+	logError(db.ReleaseIDToPoolWithError(poolName, id))
+}
+
+func (db *DB) ReleaseIDToPoolWithError(poolName string, id int32) error {
+	return db.ReleaseIDToPoolWithContext(context.Background(), poolName, id)
+}
+
+func (db *DB) ReleaseIDToPoolWithContext(ctx context.Context, poolName string, id int32) error {
+	const op = "ReleaseIDToPool"
+	logger.MongoDBLog.Println("ENTERING ReleaseIDToPool")
+	if err := db.check(op); err != nil {
+		return err
+	}
+	poolCollection := db.collection(poolName)
+
+	// releasing an id that is already free must not add it twice, it would be handed out twice.
+	_, err := poolCollection.UpdateOne(ctx, bson.M{"_id": poolName, "ids": bson.M{"$ne": id}},
+		bson.M{"$push": bson.M{"ids": id}})
+	return wrapError(op, err)
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/omec-project/MongoDBLibrary"
+)
+
+/* Allocator configurations the conformance suite runs against, with small pools so that it exhausts them. */
+var conformanceConfigs = []MongoDBLibrary.AllocatorConfig{
+	{Strategy: MongoDBLibrary.StrategyPool, Name: "conformancePool", Min: 100, Max: 108},
+	{Strategy: MongoDBLibrary.StrategyInsert, Name: "conformanceInsert", Min: 100, Max: 108, Retries: 50},
+	{Strategy: MongoDBLibrary.StrategyChunk, Name: "conformanceChunk", Min: 0, Max: 80, ChunkSize: 10, Retries: 50},
+	{Strategy: MongoDBLibrary.StrategyCounter, Name: "conformanceCounter", Min: 100, Max: 108},
+	{Strategy: MongoDBLibrary.StrategyLocal, Name: "conformanceLocal", Min: 0, Max: 20, ChunkSize: 5, Retries: 50},
+}
+
+func TestAllocatorConformance() {
+	log.Println("TESTING ALLOCATOR CONFORMANCE")
+
+	ctx := context.Background()
+	for _, cfg := range conformanceConfigs {
+		// start from an empty pool, the counter strategy counts in the counter of GetUniqueIdentity.
+		collName := cfg.Name
+		if cfg.Strategy == MongoDBLibrary.StrategyCounter {
+			collName = "counter"
+		}
+		if err := MongoDBLibrary.Client.Database("sdcore").Collection(collName).Drop(ctx); err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		alloc, err := MongoDBLibrary.NewAllocator(ctx, cfg)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		if failures := runAllocatorConformance(ctx, alloc, cfg); len(failures) > 0 {
+			for _, failure := range failures {
+				log.Printf("FAIL %s: %s", cfg.Strategy, failure)
+			}
+		} else {
+			log.Printf("PASS %s", cfg.Strategy)
+		}
+	}
+}
+
+/* Check the Allocator contract on a fresh allocator and return the violations found. */
+func runAllocatorConformance(ctx context.Context, alloc MongoDBLibrary.Allocator,
+	cfg MongoDBLibrary.AllocatorConfig) []string {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	lower, upper := cfg.Min, cfg.Max
+	capacity := int64(upper - lower)
+
+	stats, err := alloc.Stats(ctx)
+	if err != nil {
+		fail("stats of a fresh pool: %v", err)
+		return failures
+	}
+	if stats.Capacity != capacity || stats.Allocated != 0 || stats.Free != capacity {
+		fail("stats of a fresh pool: %+v", stats)
+	}
+
+	// allocating takes free ids until none is left, handing out every id of the pool exactly once.
+	allocated := map[int32]bool{}
+	for free := stats.Free; free > 0; {
+		id, err := alloc.Allocate(ctx)
+		if err != nil {
+			fail("allocation %d with %d free ids: %v", len(allocated)+1, free, err)
+			return failures
+		}
+		if id < lower || id >= upper {
+			fail("allocated %d outside [%d, %d)", id, lower, upper)
+		}
+		if allocated[id] {
+			fail("allocated %d twice", id)
+		}
+		allocated[id] = true
+
+		stats, err := alloc.Stats(ctx)
+		if err != nil || stats.Free >= free {
+			fail("allocating %d left %+v, %v", id, stats, err)
+			return failures
+		}
+		free = stats.Free
+	}
+	if int64(len(allocated)) != capacity {
+		fail("allocated %d ids out of %d", len(allocated), capacity)
+	}
+	if id, err := alloc.Allocate(ctx); !errors.Is(err, MongoDBLibrary.ErrPoolExhausted) {
+		fail("allocate from an exhausted pool: %d, %v", id, err)
+	}
+	if stats, err := alloc.Stats(ctx); err != nil || stats.Allocated != capacity || stats.Free != 0 {
+		fail("stats of an exhausted pool: %+v, %v", stats, err)
+	}
+
+	// released ids are allocated again, once even when released twice.
+	if err := alloc.Release(ctx, lower); errors.Is(err, MongoDBLibrary.ErrUnsupported) {
+		return failures
+	} else if err != nil {
+		fail("release %d: %v", lower, err)
+	}
+	if err := alloc.Release(ctx, lower); err != nil {
+		fail("release %d again: %v", lower, err)
+	}
+	if id, err := alloc.Allocate(ctx); err != nil || id != lower {
+		fail("allocate after release: %d, %v", id, err)
+	}
+	if id, err := alloc.Allocate(ctx); err == nil {
+		fail("allocated %d twice after releasing it twice", id)
+	}
+
+	// reserving works on free ids only.
+	if err := alloc.Reserve(ctx, lower); !errors.Is(err, MongoDBLibrary.ErrAlreadyAllocated) {
+		fail("reserve an allocated id: %v", err)
+	}
+	alloc.Release(ctx, lower)
+	if err := alloc.Reserve(ctx, lower); err != nil {
+		fail("reserve a free id: %v", err)
+	}
+	if id, err := alloc.Allocate(ctx); err == nil {
+		fail("allocated reserved id %d", id)
+	}
+
+	// ids outside the pool are rejected.
+	if err := alloc.Release(ctx, upper); !errors.Is(err, MongoDBLibrary.ErrOutOfRange) {
+		fail("release %d outside the pool: %v", upper, err)
+	}
+	if err := alloc.Reserve(ctx, lower-1); !errors.Is(err, MongoDBLibrary.ErrOutOfRange) {
+		fail("reserve %d outside the pool: %v", lower-1, err)
+	}
+	return failures
+}
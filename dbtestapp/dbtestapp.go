@@ -6,10 +6,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	//"context"
 	//"fmt"
 	//"os"
 
@@ -23,7 +26,7 @@ import (
 
 type Student struct {
 	//ID     		primitive.ObjectID 	`bson:"_id,omitempty"`
-	Name      	string				`bson:"name,omitempty"`
+	Name      	string				`bson:"name,omitempty" mongo:"unique"`
 	Age 	  	int 				`bson:"age,omitempty"`
 	Subject		string 				`bson:"subject,omitempty"`
 	CreatedAt 	time.Time			`bson:"createdAt,omitempty"`
@@ -50,11 +53,721 @@ func main() {
 	// test getting chunk of ids from pool
 	TestGetChunkFromPool()
 
+	// test using a second database next to the default one
+	TestMultipleDatabases()
+
+	// test the error returning variants
+	TestErrorHandling()
+
+	// test passing a deadline to the context variants
+	TestContextDeadline()
+
+	// test writing many documents in one bulk operation
+	TestBulkWrite()
+
+	// test paging through a collection
+	TestPagination()
+
+	// test walking a collection one document at a time
+	TestIterator()
+
+	// test that patches keep the bson types of the fields
+	TestPatchTypes()
+
+	// test that concurrent patches of one document are not lost
+	TestConcurrentPatch()
+
+	// test that fields removed by a patch are removed from the database
+	TestPatchRemove()
+
+	// test patching a nested part of a document
+	TestPatchExtend()
+
+	// test json patches guarded by test operations
+	TestPatchPrecondition()
+
+	// test conditional writes with entity tags
+	TestETag()
+
+	// test the delete results and returning the deleted documents
+	TestDelete()
+
+	// test deleting and restoring documents of a soft delete collection
+	TestSoftDelete()
+
+	// test provisioning a subscriber in one transaction
+	TestTransaction()
+
+	// test change stream subscription
+	TestWatch()
+
+	// test the read cache
+	TestCache()
+
+	// test declaring and reconciling indexes
+	TestIndexes()
+
+	// test every allocation strategy against the Allocator contract
+	TestAllocatorConformance()
+
+	// test sharing pool definitions between instances
+	TestPoolMetadata()
+
+	// test leased chunks and their takeover
+	TestChunkLease()
+
+	// test allocating single ids from locally held chunks
+	TestLocalAllocator()
+
 	for {
 		time.Sleep(100 * time.Second)
 	}
 }
 
+func TestMultipleDatabases() {
+	log.Println("TESTING MULTIPLE DATABASES")
+
+	poolDB, err := MongoDBLibrary.NewDB("sdcore-pools", "mongodb://mongodb:27017", nil)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	putData := bson.M{}
+	putData["name"] = "Yak"
+	filter := bson.M{}
+	filter["name"] = "Yak"
+	poolDB.RestfulAPIPutOne("animals", filter, putData)
+
+	log.Println(poolDB.RestfulAPIGetOne("animals", filter))
+	log.Println(MongoDBLibrary.RestfulAPIGetOne("animals", filter))
+}
+
+func TestErrorHandling() {
+	log.Println("TESTING ERROR HANDLING")
+
+	filter := bson.M{}
+	filter["name"] = "Nerf Doodle"
+	_, err := MongoDBLibrary.RestfulAPIGetOneWithError("student", filter)
+	if errors.Is(err, MongoDBLibrary.ErrNotFound) {
+		log.Println("student not found as expected: " + err.Error())
+	}
+
+	err = MongoDBLibrary.RestfulAPIJSONPatchWithError("student", bson.M{"name": "Osman Amjad"}, []byte("not a patch"))
+	if errors.Is(err, MongoDBLibrary.ErrInvalidPatch) {
+		log.Println("invalid patch rejected as expected: " + err.Error())
+	}
+}
+
+func TestContextDeadline() {
+	log.Println("TESTING CONTEXT DEADLINE")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	_, err := MongoDBLibrary.RestfulAPIGetManyWithContext(ctx, "student", bson.M{})
+	if errors.Is(err, MongoDBLibrary.ErrTimeout) {
+		log.Println("query timed out as expected: " + err.Error())
+	}
+}
+
+func TestBulkWrite() {
+	log.Println("TESTING BULK WRITE")
+
+	var filterArray []bson.M
+	var putDataArray []map[string]interface{}
+	for i := 0; i < 10; i++ {
+		filterArray = append(filterArray, bson.M{"imsi": i})
+		putDataArray = append(putDataArray, map[string]interface{}{"imsi": i, "plmn": "20893"})
+	}
+	result, err := MongoDBLibrary.RestfulAPIPutManyWithError("subscribers", filterArray, putDataArray,
+		&MongoDBLibrary.BulkOptions{Unordered: true, BatchSize: 4})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	if result != nil {
+		log.Println("inserted", result.Inserted, "updated", result.Updated, "failed", result.Failed)
+		for i, item := range result.Items {
+			if item.Err != nil {
+				log.Println("item", i, item.Status, item.Err.Error())
+			}
+		}
+	}
+
+	// posting documents that carry their _id again updates them, the others would be inserted once more.
+	var postDataArray []interface{}
+	for i := 0; i < 10; i++ {
+		postDataArray = append(postDataArray, bson.M{"_id": fmt.Sprint("imsi-", i), "imsi": i, "msisdn": 1000 + i})
+	}
+	for round := 0; round < 2; round++ {
+		result, err = MongoDBLibrary.RestfulAPIPostManyWithError("subscribers", nil, postDataArray)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		if result != nil {
+			log.Println("posted: inserted", result.Inserted, "updated", result.Updated, "failed", result.Failed)
+		}
+	}
+}
+
+func TestPagination() {
+	log.Println("TESTING PAGINATION")
+
+	// subscribers with a null or no imsi sort last in descending order and must not be lost at a page boundary.
+	for _, doc := range []map[string]interface{}{{"tag": "nullImsi", "imsi": nil}, {"tag": "noImsi"}} {
+		if _, err := MongoDBLibrary.RestfulAPIPostWithError("subscribers", bson.M{"tag": doc["tag"]}, doc); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	count, err := MongoDBLibrary.Client.Database("sdcore").Collection("subscribers").CountDocuments(
+		context.Background(), bson.M{})
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	for _, order := range []int{-1, 1} {
+		opts := &MongoDBLibrary.QueryOptions{
+			Limit:      3,
+			Sort:       bson.D{{Key: "imsi", Value: order}},
+			Projection: bson.M{"imsi": 1},
+		}
+		seen := 0
+		for {
+			page, err := MongoDBLibrary.RestfulAPIGetPage(context.Background(), "subscribers", bson.M{}, opts)
+			if err != nil {
+				log.Println(err.Error())
+				return
+			}
+			log.Println(page.Items)
+			seen += len(page.Items)
+			if page.NextPageToken == "" {
+				break
+			}
+			opts.PageToken = page.NextPageToken
+		}
+		if int64(seen) != count {
+			log.Println("FAIL: paging in order", order, "returned", seen, "of", count, "subscribers")
+		}
+	}
+}
+
+func TestIterator() {
+	log.Println("TESTING ITERATOR")
+
+	count := 0
+	err := MongoDBLibrary.ForEach(context.Background(), "student", bson.M{},
+		&MongoDBLibrary.QueryOptions{BatchSize: 2}, func(it *MongoDBLibrary.Iterator) error {
+			var student Student
+			if err := it.Decode(&student); err != nil {
+				return err
+			}
+			log.Println(student.Name, student.Age)
+			count++
+			return nil
+		})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("visited", count, "students")
+}
+
+func TestPatchTypes() {
+	log.Println("TESTING PATCH TYPES")
+
+	filter := bson.M{"imsi": "208930000000001"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{
+		"imsi":      "208930000000001",
+		"sqn":       int32(1),
+		"bitRate":   int64(1000000),
+		"createdAt": time.Now(),
+	})
+
+	err := MongoDBLibrary.RestfulAPIMergePatchWithError("patches", filter, map[string]interface{}{"sqn": 2.0})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	patch := []byte(`[{"op": "replace", "path": "/bitRate", "value": 2000000},
+		{"op": "replace", "path": "/createdAt", "value": "2021-06-01T00:00:00Z"}]`)
+	if err := MongoDBLibrary.RestfulAPIJSONPatchWithError("patches", filter, patch); err != nil {
+		log.Println(err.Error())
+	}
+
+	doc, err := MongoDBLibrary.GetOneCustomDataStructure("patches", filter)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	for _, field := range []string{"sqn", "bitRate", "createdAt"} {
+		log.Printf("%s: %v (%T)", field, doc[field], doc[field])
+	}
+}
+
+func TestConcurrentPatch() {
+	log.Println("TESTING CONCURRENT PATCH")
+
+	filter := bson.M{"imsi": "208930000000002"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{
+		"imsi":     "208930000000002",
+		"sessions": bson.A{},
+	})
+
+	// every patch appends to the array and writes it back as a whole, so a patch that is not retried after a
+	// concurrent one would drop the value the other one appended.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patch := []byte(fmt.Sprintf(`[{"op": "add", "path": "/sessions/-", "value": %d}]`, i))
+			err := MongoDBLibrary.RestfulAPIJSONPatchWithError("patches", filter, patch,
+				&MongoDBLibrary.WriteOptions{Retries: 20})
+			if errors.Is(err, MongoDBLibrary.ErrWriteConflict) {
+				log.Println("patch", i, "gave up after 20 retries")
+			} else if err != nil {
+				log.Println(err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	doc := MongoDBLibrary.RestfulAPIGetOne("patches", filter)
+	log.Println("sessions after 10 concurrent patches:", doc["sessions"])
+}
+
+func TestPatchRemove() {
+	log.Println("TESTING PATCH REMOVE")
+
+	filter := bson.M{"imsi": "208930000000003"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{
+		"imsi":     "208930000000003",
+		"msisdn":   "0900000003",
+		"ambr":     map[string]interface{}{"uplink": "1 Gbps", "downlink": "2 Gbps"},
+		"sessions": bson.A{"internet", "ims"},
+	})
+
+	// null removes a member in a merge patch, also inside nested documents.
+	err := MongoDBLibrary.RestfulAPIMergePatchWithError("patches", filter, map[string]interface{}{
+		"msisdn": nil,
+		"ambr":   map[string]interface{}{"uplink": nil},
+	})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	err = MongoDBLibrary.RestfulAPIJSONPatchWithError("patches", filter,
+		[]byte(`[{"op": "remove", "path": "/sessions/0"}, {"op": "remove", "path": "/ambr/downlink"}]`))
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	doc := MongoDBLibrary.RestfulAPIGetOne("patches", filter)
+	if _, ok := doc["msisdn"]; ok {
+		log.Println("msisdn was not removed")
+	}
+	if ambr, _ := doc["ambr"].(map[string]interface{}); len(ambr) != 0 {
+		log.Println("ambr members were not removed:", ambr)
+	}
+	if sessions, _ := doc["sessions"].(bson.A); len(sessions) != 1 || sessions[0] != "ims" {
+		log.Println("sessions[0] was not removed:", doc["sessions"])
+	}
+	log.Println("document after removing fields:", doc)
+}
+
+func TestPatchExtend() {
+	log.Println("TESTING PATCH EXTEND")
+
+	filter := bson.M{"imsi": "208930000000004"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{
+		"imsi": "208930000000004",
+		"smData": bson.A{
+			map[string]interface{}{"sst": 1, "dnns": bson.A{"internet"}},
+		},
+	})
+
+	// an array nested in an array element, addressed by a JSON pointer.
+	err := MongoDBLibrary.RestfulAPIJSONPatchExtendWithError("patches", filter,
+		[]byte(`[{"op": "add", "path": "/-", "value": "ims"}]`), "/smData/0/dnns")
+	if err != nil {
+		log.Println(err.Error())
+	}
+	// a scalar addressed by a dotted path.
+	err = MongoDBLibrary.RestfulAPIJSONPatchExtendWithError("patches", filter,
+		[]byte(`[{"op": "replace", "path": "", "value": 2}]`), "smData.0.sst")
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	doc := MongoDBLibrary.RestfulAPIGetOne("patches", filter)
+	log.Println("smData after patching:", doc["smData"])
+}
+
+func TestPatchPrecondition() {
+	log.Println("TESTING PATCH PRECONDITION")
+
+	filter := bson.M{"imsi": "208930000000005"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{
+		"imsi":  "208930000000005",
+		"state": "registered",
+	})
+
+	// only deregister a subscriber that is still registered.
+	patch := []byte(`[{"op": "test", "path": "/state", "value": "registered"},
+		{"op": "replace", "path": "/state", "value": "deregistered"}]`)
+	if err := MongoDBLibrary.RestfulAPIJSONPatchWithError("patches", filter, patch); err != nil {
+		log.Println(err.Error())
+	}
+	// the second attempt finds the subscriber deregistered already.
+	err := MongoDBLibrary.RestfulAPIJSONPatchWithError("patches", filter, patch)
+	if errors.Is(err, MongoDBLibrary.ErrPreconditionFailed) {
+		log.Println("second deregistration refused, reply 412:", err.Error())
+	} else {
+		log.Println("expected a precondition failure, got", err)
+	}
+}
+
+func TestETag() {
+	log.Println("TESTING ETAG")
+
+	ctx := context.Background()
+	filter := bson.M{"imsi": "208930000000006"}
+	MongoDBLibrary.RestfulAPIPutOne("patches", filter, map[string]interface{}{"imsi": "208930000000006", "sqn": 1})
+
+	_, tag, err := MongoDBLibrary.RestfulAPIGetOneWithETag(ctx, "patches", filter)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	log.Println("etag:", tag)
+
+	// a put with the current tag succeeds and changes the tag.
+	_, err = MongoDBLibrary.RestfulAPIPutOneWithContext(ctx, "patches", filter,
+		map[string]interface{}{"sqn": 2}, &MongoDBLibrary.WriteOptions{IfMatch: tag})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	// the old tag no longer matches, neither for patches nor for deletes.
+	err = MongoDBLibrary.RestfulAPIMergePatchWithContext(ctx, "patches", filter,
+		map[string]interface{}{"sqn": 3}, &MongoDBLibrary.WriteOptions{IfMatch: tag})
+	if errors.Is(err, MongoDBLibrary.ErrPreconditionFailed) {
+		log.Println("stale patch refused, reply 412")
+	}
+	_, err = MongoDBLibrary.RestfulAPIDeleteOneWithContext(ctx, "patches", filter,
+		&MongoDBLibrary.WriteOptions{IfMatch: tag})
+	if errors.Is(err, MongoDBLibrary.ErrPreconditionFailed) {
+		log.Println("stale delete refused, reply 412")
+	}
+
+	_, tag, _ = MongoDBLibrary.RestfulAPIGetOneWithETag(ctx, "patches", filter)
+	log.Println("etag after put:", tag)
+}
+
+func TestDelete() {
+	log.Println("TESTING DELETE")
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		MongoDBLibrary.RestfulAPIPutOne("deletes", bson.M{"id": i}, map[string]interface{}{"id": i, "group": "a"})
+	}
+
+	deleted, err := MongoDBLibrary.RestfulAPIDeleteOneWithError("deletes", bson.M{"id": 42})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("deleting a missing document deleted", deleted)
+
+	doc, err := MongoDBLibrary.RestfulAPIFindOneAndDelete(ctx, "deletes", bson.M{"id": 0})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("deleted document:", doc)
+
+	docs, err := MongoDBLibrary.RestfulAPIFindManyAndDelete(ctx, "deletes", bson.M{"group": "a"})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("deleted", len(docs), "more documents:", docs)
+
+	_, err = MongoDBLibrary.RestfulAPIFindOneAndDelete(ctx, "deletes", bson.M{"id": 0})
+	if errors.Is(err, MongoDBLibrary.ErrNotFound) {
+		log.Println("document is gone, reply 404")
+	}
+}
+
+func TestSoftDelete() {
+	log.Println("TESTING SOFT DELETE")
+
+	ctx := context.Background()
+	err := MongoDBLibrary.EnableSoftDelete(ctx, "subscribersSoft",
+		&MongoDBLibrary.SoftDeleteOptions{Retention: 7 * 24 * time.Hour})
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	filter := bson.M{"imsi": "208930000000007"}
+	MongoDBLibrary.RestfulAPIPutOne("subscribersSoft", filter, map[string]interface{}{"imsi": "208930000000007"})
+	if _, err := MongoDBLibrary.RestfulAPIDeleteOneWithError("subscribersSoft", filter); err != nil {
+		log.Println(err.Error())
+	}
+	if doc := MongoDBLibrary.RestfulAPIGetOne("subscribersSoft", filter); doc != nil {
+		log.Println("deleted subscriber is still visible:", doc)
+	}
+
+	page, err := MongoDBLibrary.RestfulAPIGetPage(ctx, "subscribersSoft", filter,
+		&MongoDBLibrary.QueryOptions{IncludeDeleted: true})
+	if err == nil && len(page.Items) == 1 {
+		log.Println("tombstone:", page.Items[0])
+	}
+
+	restored, err := MongoDBLibrary.RestoreDeleted(ctx, "subscribersSoft", filter)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("restored", restored, "subscriber:", MongoDBLibrary.RestfulAPIGetOne("subscribersSoft", filter))
+
+	// a put on a tombstone starts a new document, none of the deleted fields come back.
+	MongoDBLibrary.RestfulAPIPutOne("subscribersSoft", filter,
+		map[string]interface{}{"imsi": "208930000000007", "plmn": "20893"})
+	MongoDBLibrary.RestfulAPIDeleteOne("subscribersSoft", filter)
+	existed, err := MongoDBLibrary.RestfulAPIPutOneWithError("subscribersSoft", filter,
+		map[string]interface{}{"msisdn": "0900000007"})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("existed", existed, "after put on tombstone:", MongoDBLibrary.RestfulAPIGetOne("subscribersSoft", filter))
+
+	MongoDBLibrary.RestfulAPIDeleteOne("subscribersSoft", filter)
+	existed, err = MongoDBLibrary.RestfulAPIPutOneNotUpdateWithError("subscribersSoft", filter,
+		map[string]interface{}{"imsi": "208930000000007"})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("existed", existed, "after put-if-absent on tombstone:",
+		MongoDBLibrary.RestfulAPIGetOne("subscribersSoft", filter))
+}
+
+func TestTransaction() {
+	log.Println("TESTING TRANSACTION")
+
+	provision := func(tx *MongoDBLibrary.Tx) error {
+		filter := bson.M{"ueId": "imsi-208930000000008"}
+		if _, err := tx.RestfulAPIPutOne("subscriptionData.authenticationData.authenticationSubscription", filter,
+			map[string]interface{}{"ueId": "imsi-208930000000008", "authenticationMethod": "5G_AKA"}); err != nil {
+			return err
+		}
+		if _, err := tx.RestfulAPIPutOne("subscriptionData.provisionedData.amData", filter,
+			map[string]interface{}{"ueId": "imsi-208930000000008", "gpsis": bson.A{"msisdn-0900000008"}}); err != nil {
+			return err
+		}
+		_, err := tx.RestfulAPIPutOne("policyData.ues.amData", filter,
+			map[string]interface{}{"ueId": "imsi-208930000000008", "subscCats": bson.A{"free5gc"}})
+		return err
+	}
+
+	ctx := context.Background()
+	err := MongoDBLibrary.WithTransaction(ctx, provision)
+	if errors.Is(err, MongoDBLibrary.ErrTransactionsUnsupported) {
+		log.Println("standalone server, provisioning without a transaction")
+		err = MongoDBLibrary.WithTransaction(ctx, provision, &MongoDBLibrary.TxOptions{AllowStandalone: true})
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func TestWatch() {
+	log.Println("TESTING WATCH")
+
+	collName := "subscriptionData.provisionedData.smData"
+	filter := bson.M{"servingPlmnId": "20893"}
+	handler := func(event MongoDBLibrary.ChangeEvent) error {
+		log.Println("change event:", event.Type, event.DocumentKey, event.Document)
+		return nil
+	}
+	// the subscription name keeps the resume token, a restarted process continues after the last handled event.
+	opts := &MongoDBLibrary.WatchOptions{Name: "dbtestapp-smData"}
+	watcher, err := MongoDBLibrary.Watch(context.Background(), collName, filter, handler, opts)
+	if err != nil {
+		// change streams need a replica set.
+		log.Println(err.Error())
+		return
+	}
+
+	ueFilter := bson.M{"ueId": "imsi-208930000000009", "servingPlmnId": "20893"}
+	MongoDBLibrary.RestfulAPIPutOne(collName, ueFilter,
+		map[string]interface{}{"ueId": "imsi-208930000000009", "servingPlmnId": "20893", "singleNssai": "01"})
+	MongoDBLibrary.RestfulAPIMergePatch(collName, ueFilter, map[string]interface{}{"singleNssai": "02"})
+	MongoDBLibrary.RestfulAPIDeleteOne(collName, ueFilter)
+
+	time.Sleep(time.Second)
+	if err := watcher.Stop(); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func TestCache() {
+	log.Println("TESTING CACHE")
+
+	collName := "policyData.ues.amData"
+	opts := &MongoDBLibrary.CacheOptions{MaxEntries: 100, TTL: time.Minute, Refresh: true}
+	if err := MongoDBLibrary.EnableCache(context.Background(), collName, opts); err != nil {
+		// the cache is kept coherent by a change stream, which needs a replica set.
+		log.Println(err.Error())
+		return
+	}
+	defer MongoDBLibrary.DisableCache(collName)
+
+	filter := bson.M{"ueId": "imsi-208930000000008"}
+	MongoDBLibrary.RestfulAPIPutOne(collName, filter,
+		map[string]interface{}{"ueId": "imsi-208930000000008", "subscCats": bson.A{"free5gc"}})
+	for i := 0; i < 3; i++ {
+		log.Println(MongoDBLibrary.RestfulAPIGetOne(collName, filter))
+	}
+	stats, _ := MongoDBLibrary.GetCacheStats(collName)
+	log.Printf("cache hits %d, misses %d, entries %d", stats.Hits, stats.Misses, stats.Entries)
+}
+
+func TestIndexes() {
+	log.Println("TESTING INDEXES")
+
+	MongoDBLibrary.DeclareIndexes("subscriptionData.provisionedData.amData",
+		MongoDBLibrary.Index{Keys: []string{"ueId", "servingPlmnId"}, Unique: true},
+		MongoDBLibrary.Index{Keys: []string{"gpsis"}, Sparse: true})
+	MongoDBLibrary.DeclareIndexes("policyData.ues.amData",
+		MongoDBLibrary.Index{Keys: []string{"ueId"}, Unique: true,
+			PartialFilter: bson.M{"ueId": bson.M{"$exists": true}}})
+	MongoDBLibrary.DeclareIndexes("sessionData",
+		MongoDBLibrary.Index{Name: "expiry", Keys: []string{"lastSeen"}, TTL: time.Hour})
+
+	report, err := MongoDBLibrary.EnsureIndexes(context.Background(), nil)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("created", report.Created, "modified", report.Modified)
+
+	// a changed TTL is applied to the existing index with collMod.
+	MongoDBLibrary.DeclareIndexes("sessionData",
+		MongoDBLibrary.Index{Name: "expiry", Keys: []string{"lastSeen"}, TTL: 2 * time.Hour})
+	report, err = MongoDBLibrary.EnsureIndexes(context.Background(), &MongoDBLibrary.EnsureIndexesOptions{})
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("created", report.Created, "modified", report.Modified)
+}
+
+func TestPoolMetadata() {
+	log.Println("TESTING POOL METADATA")
+
+	ctx := context.Background()
+	if err := MongoDBLibrary.InitializeChunkPoolWithContext(ctx, "sharedChunks", 0, 1000, 5, 100); err != nil {
+		log.Println(err.Error())
+	}
+
+	// another instance can use the pool without initializing it, the definition is loaded from the database.
+	replica := MongoDBLibrary.NewDBFromClient(MongoDBLibrary.Client, "sdcore", nil)
+	chunk, lower, upper, err := replica.GetChunkFromPoolWithContext(ctx, "sharedChunks")
+	if err != nil {
+		log.Println(err.Error())
+	} else {
+		log.Println("replica got chunk", chunk, "with range", lower, "-", upper)
+		replica.ReleaseChunkToPoolWithContext(ctx, "sharedChunks", chunk)
+	}
+
+	// initializing it with another chunk size would make instances hand out overlapping ranges.
+	err = replica.InitializeChunkPoolWithContext(ctx, "sharedChunks", 0, 1000, 5, 50)
+	if errors.Is(err, MongoDBLibrary.ErrPoolConflict) {
+		log.Println("conflicting definition rejected:", err)
+	}
+}
+
+func TestChunkLease() {
+	log.Println("TESTING CHUNK LEASE")
+
+	ctx := context.Background()
+	if err := MongoDBLibrary.InitializeChunkPoolWithContext(ctx, "leasedChunks", 0, 40, 20, 10); err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	// the lease of a dead instance, which stops renewing, expires and its chunk can be taken over.
+	opts := &MongoDBLibrary.LeaseOptions{Duration: 2 * time.Second, Owner: "dead-pod", ManualRenew: true}
+	dead, err := MongoDBLibrary.AcquireChunkLease(ctx, "leasedChunks", opts)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	log.Println("dead-pod leased chunk", dead.Chunk, "with token", dead.Token)
+
+	var leases []*MongoDBLibrary.ChunkLease
+	for attempt := 0; len(leases) < 4 && attempt < 10; attempt++ {
+		lease, err := MongoDBLibrary.AcquireChunkLease(ctx, "leasedChunks",
+			&MongoDBLibrary.LeaseOptions{Duration: 10 * time.Second})
+		if err != nil {
+			// all chunks are leased until the one of dead-pod expires.
+			log.Println(err.Error())
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		log.Println("leased chunk", lease.Chunk, "range", lease.Lower, "-", lease.Upper, "token", lease.Token)
+		leases = append(leases, lease)
+	}
+
+	// the stale owner detects that it lost the chunk through the fencing token.
+	if err := dead.Renew(ctx); errors.Is(err, MongoDBLibrary.ErrLeaseLost) {
+		log.Println("dead-pod lost chunk", dead.Chunk)
+	}
+	for _, lease := range leases {
+		if err := lease.Release(ctx); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+func TestLocalAllocator() {
+	log.Println("TESTING LOCAL ALLOCATOR")
+
+	ctx := context.Background()
+	if err := MongoDBLibrary.InitializeChunkPoolWithContext(ctx, "localIds", 0, 100, 20, 10); err != nil {
+		log.Println(err.Error())
+		return
+	}
+	alloc, err := MongoDBLibrary.NewLocalAllocator(ctx, "localIds", 0.5)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	// past half of the first chunk the next one is fetched in the background.
+	var ids []int32
+	for i := 0; i < 15; i++ {
+		id, err := alloc.Allocate(ctx)
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+		ids = append(ids, id)
+	}
+	log.Println("allocated", ids)
+	if stats, err := alloc.Stats(ctx); err == nil {
+		log.Printf("stats after allocating: %+v", stats)
+	}
+
+	// once all ids of a chunk are released it goes back to the pool.
+	for _, id := range ids[:10] {
+		if err := alloc.Release(ctx, id); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	if stats, err := alloc.Stats(ctx); err == nil {
+		log.Printf("stats after releasing the first chunk: %+v", stats)
+	}
+	for _, id := range ids[10:] {
+		alloc.Release(ctx, id)
+	}
+	if err := alloc.Close(ctx); err != nil {
+		log.Println(err.Error())
+	}
+}
+
 func TestGetChunkFromPool() {
 	log.Println("TESTING CHUNK APPROACH")
 
@@ -73,6 +786,13 @@ func TestGetChunkFromPool() {
 	if (err != nil) {log.Println(err.Error())}
 
 	MongoDBLibrary.ReleaseChunkToPool("studentIdsChunkApproach", randomId)
+
+	// chunks claimed before chunks had leases expire from now on.
+	migrated, err := MongoDBLibrary.MigrateChunkPool(context.Background(), "studentIdsChunkApproach")
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Println("leased", migrated, "chunks without expiry")
 }
 
 func TestGetIdFromPool() {
@@ -138,6 +858,11 @@ func TestGetUniqueIdentity() {
 }
 
 func TestCustomDataStructure() {
+	// names are the key of the student collection, so make sure they stay unique across concurrent writers.
+	if err := students().EnsureIndexes(context.Background()); err != nil {
+		log.Println(err.Error())
+	}
+
 	insertStudentInDB("Osman Amjad", 21)
 	student, err := getStudentFromDB("Osman Amjad")
 	if err == nil {
@@ -173,20 +898,15 @@ func TestDocumentWithTimeout() {
 	MongoDBLibrary.PutOneWithTimeout("timeout", filter, putData, 120, "createdAt")
 }
 
+func students() *MongoDBLibrary.Collection[Student] {
+	return MongoDBLibrary.NewCollection[Student](MongoDBLibrary.DefaultDB(), "student")
+}
+
 func getStudentFromDB(name string) (Student, error) {
-	var student Student
 	filter := bson.M{}
 	filter["name"] = name
 
-	result, err := MongoDBLibrary.GetOneCustomDataStructure("student", filter)
-
-	if err == nil {
-		bsonBytes, _ := bson.Marshal(result)
-		bson.Unmarshal(bsonBytes, &student)
-
-		return student, nil
-	}
-	return student, err
+	return students().Get(context.Background(), filter)
 }
 
 func insertStudentInDB(name string, age int) {
@@ -196,5 +916,6 @@ func insertStudentInDB(name string, age int) {
 		CreatedAt: time.Now(),
 	}
 	filter := bson.M{}
+	filter["name"] = name
 	MongoDBLibrary.PutOneCustomDataStructure("student", filter, student)
 }
\ No newline at end of file
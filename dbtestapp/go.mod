@@ -1,6 +1,6 @@
 module testapp
 
-go 1.15
+go 1.18
 
 require (
 	github.com/free5gc/logger_util v1.0.0 // indirect
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Sentinel errors returned by the error returning API. Check them with errors.Is, the driver error that caused
+// them stays reachable through errors.Unwrap.
+var (
+	ErrNotConnected     = errors.New("not connected to mongodb")
+	ErrNotFound         = errors.New("document not found")
+	ErrDuplicateKey     = errors.New("duplicate key")
+	ErrInvalidPatch     = errors.New("invalid patch")
+	ErrPatchConflict    = errors.New("patch cannot be applied to the document")
+	ErrWriteConflict    = errors.New("document was modified concurrently")
+	ErrTimeout          = errors.New("operation timed out")
+	ErrOutOfRange       = errors.New("unique identity is out of range")
+	ErrInvalidPool      = errors.New("invalid pool parameters")
+	ErrPoolNotFound     = errors.New("pool has not been initialized")
+	ErrPoolConflict     = errors.New("pool is defined with different parameters")
+	ErrPoolExhausted    = errors.New("pool has no free id left")
+	ErrLeaseLost        = errors.New("chunk lease was lost")
+	ErrNotOwner         = errors.New("chunk is held by another owner")
+	ErrInvalidPageToken = errors.New("invalid page token")
+	ErrIndexConflict    = errors.New("index conflicts with its declaration")
+	ErrAlreadyAllocated = errors.New("id is already allocated")
+	ErrUnsupported      = errors.New("not supported by the allocation strategy")
+
+	ErrTransactionsUnsupported = errors.New("transactions need a replica set or a sharded cluster")
+
+	// ErrPreconditionFailed reports a failed JSON patch test or If-Match check, REST handlers answer it with 412
+	// Precondition Failed.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+/* Error is returned by every error returning function. Kind holds the sentinel the error matches, Err the cause. */
+type Error struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil || e.Err == e.Kind {
+		return e.Op + ": " + e.Kind.Error()
+	}
+	if e.Kind == nil {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return e.Op + ": " + e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+/* Build an error of the given kind for op. */
+func newError(op string, kind error, err error) error {
+	if err == nil {
+		err = kind
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+/* Wrap a driver error for op, classifying it as one of the sentinel errors when possible. */
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	var kind error
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		kind = ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		kind = ErrDuplicateKey
+	case mongo.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		kind = ErrTimeout
+	case errors.Is(err, mongo.ErrClientDisconnected):
+		kind = ErrNotConnected
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+/* Check that db can be used for op. */
+func (db *DB) check(op string) error {
+	if db == nil || db.Client == nil {
+		return newError(op, ErrNotConnected, nil)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Entity tags are derived from the revision counter stored in every document (see revisionField), so all replicas
+// of a network function compute the same tag for the same document version. Tags are returned in their quoted HTTP
+// form, such as "3", ready for an ETag header, and the If-Match value of a request can be passed to the write
+// functions as is through WriteOptions.IfMatch, "*" included.
+
+/* Return the document matching filter together with its entity tag. */
+func (db *DB) RestfulAPIGetOneWithETag(ctx context.Context, collName string,
+	filter bson.M) (map[string]interface{}, string, error) {
+	const op = "RestfulAPIGetOneWithETag"
+	if err := db.check(op); err != nil {
+		return nil, "", err
+	}
+
+	filter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return nil, "", wrapError(op, err)
+	}
+	var result map[string]interface{}
+	if err := db.collection(collName).FindOne(ctx, filter).Decode(&result); err != nil {
+		return nil, "", wrapError(op, err)
+	}
+	tag := formatETag(result[revisionField])
+	stripRevision(result)
+	return result, tag, nil
+}
+
+/* Return the documents matching filter together with their entity tags, tags[i] belongs to results[i]. */
+func (db *DB) RestfulAPIGetManyWithETag(ctx context.Context, collName string,
+	filter bson.M) (results []map[string]interface{}, tags []string, err error) {
+	const op = "RestfulAPIGetManyWithETag"
+	if err := db.check(op); err != nil {
+		return nil, nil, err
+	}
+
+	if filter, err = db.readFilter(ctx, collName, filter); err != nil {
+		return nil, nil, wrapError(op, err)
+	}
+	cur, err := db.collection(collName).Find(ctx, filter)
+	if err != nil {
+		return nil, nil, wrapError(op, err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var result map[string]interface{}
+		if err := cur.Decode(&result); err != nil {
+			return nil, nil, wrapError(op, err)
+		}
+		tags = append(tags, formatETag(result[revisionField]))
+		stripRevision(result)
+		results = append(results, result)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, nil, wrapError(op, err)
+	}
+	return results, tags, nil
+}
+
+/* Return the entity tag of the revision rev, documents without a revision are at revision 0. */
+func formatETag(rev interface{}) string {
+	return `"` + strconv.FormatInt(revisionNumber(rev), 10) + `"`
+}
+
+func revisionNumber(rev interface{}) int64 {
+	switch r := rev.(type) {
+	case int32:
+		return int64(r)
+	case int64:
+		return r
+	case float64:
+		return int64(r)
+	}
+	return 0
+}
+
+/* Parse an If-Match value. Weak tags never match, as If-Match uses the strong comparison. */
+func parseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	rev, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	return rev, err == nil && rev >= 0
+}
+
+/* Return the revision an If-Match value expects. ok is false when no revision can match it. */
+func expectedRevision(ifMatch string) (rev int64, wildcard bool, ok bool) {
+	if strings.TrimSpace(ifMatch) == "*" {
+		return 0, true, true
+	}
+	rev, ok = parseETag(ifMatch)
+	return rev, false, ok
+}
+
+/* Restrict filter to the documents whose tag matches ifMatch. */
+func ifMatchFilter(filter bson.M, ifMatch string) (bson.M, bool) {
+	rev, wildcard, ok := expectedRevision(ifMatch)
+	if !ok {
+		return nil, false
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if wildcard {
+		return filter, true
+	}
+	clause := bson.M{revisionField: rev}
+	if rev == 0 {
+		clause = bson.M{revisionField: bson.M{"$exists": false}}
+	}
+	return bson.M{"$and": bson.A{filter, clause}}, true
+}
+
+/* Run update on the document matching filter only if its tag matches ifMatch, without upserting. */
+func (db *DB) updateIfMatch(ctx context.Context, op string, collection *mongo.Collection, filter bson.M,
+	update interface{}, ifMatch string) error {
+	defer db.invalidateCache(collection.Name())
+	filter, ok := ifMatchFilter(filter, ifMatch)
+	if !ok {
+		return newError(op, ErrPreconditionFailed, nil)
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if result.MatchedCount == 0 {
+		return newError(op, ErrPreconditionFailed, nil)
+	}
+	return nil
+}
@@ -1,10 +1,9 @@
 module github.com/omec-project/MongoDBLibrary
 
-go 1.14
+go 1.18
 
 require (
 	github.com/antonfisher/nested-logrus-formatter v1.3.1
-	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/free5gc/MongoDBLibrary v1.0.0
 	github.com/free5gc/logger_conf v1.0.0
 	github.com/free5gc/logger_util v1.0.0
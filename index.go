@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* Index declares an index of a collection, see DeclareIndexes. */
+type Index struct {
+	// Name defaults to the name MongoDB derives from the keys, like "plmn_1_imsi_-1".
+	Name string
+	// Keys lists the indexed fields in order, a field prefixed with "-" is indexed in descending order. More than one
+	// field makes a compound index.
+	Keys   []string
+	Unique bool
+	// Sparse leaves out the documents that do not have the indexed fields.
+	Sparse bool
+	// TTL makes a TTL index, which removes a document once its single key, a date field, is older than TTL.
+	TTL time.Duration
+	// Expire makes a TTL index with a TTL of 0, which removes a document once the date in its key has passed. A TTL
+	// above 0 implies it.
+	Expire bool
+	// PartialFilter restricts the index to the documents matching it.
+	PartialFilter bson.M
+}
+
+/* EnsureIndexesOptions tunes EnsureIndexes. */
+type EnsureIndexesOptions struct {
+	// DropUndeclared drops the indexes of the collection that are not declared, except the _id index.
+	DropUndeclared bool
+	// Rebuild drops and recreates an index whose keys, unique, sparse or partial filter options differ from the
+	// declaration. Without it such a conflict fails with ErrIndexConflict. A changed TTL never needs a rebuild.
+	Rebuild bool
+}
+
+/* IndexReport lists what EnsureIndexes changed, as collection.index names. */
+type IndexReport struct {
+	Created  []string
+	Modified []string
+	Rebuilt  []string
+	Dropped  []string
+}
+
+/* indexInfo is an existing index as listed by the server. */
+type indexInfo struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+	PartialFilter      bson.M `bson:"partialFilterExpression"`
+}
+
+/* Declare the indexes of collName, replacing an earlier declaration. EnsureIndexes creates them. */
+func (db *DB) DeclareIndexes(collName string, indexes ...Index) error {
+	const op = "DeclareIndexes"
+	if db == nil {
+		return newError(op, ErrNotConnected, nil)
+	}
+	for _, index := range indexes {
+		if err := index.validate(); err != nil {
+			return newError(op, nil, fmt.Errorf("collection %s: %w", collName, err))
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.indexes[collName] = append([]Index(nil), indexes...)
+	return nil
+}
+
+/* Bring the indexes of every collection declared with DeclareIndexes in line with the declarations: missing indexes
+ * are created, changed TTLs are applied with collMod, and depending on opts conflicting indexes are rebuilt and
+ * undeclared ones dropped. The report lists the changes made, also when an error stopped the reconciliation. */
+func (db *DB) EnsureIndexes(ctx context.Context, opts *EnsureIndexesOptions) (*IndexReport, error) {
+	const op = "EnsureIndexes"
+	report := &IndexReport{}
+	if err := db.check(op); err != nil {
+		return report, err
+	}
+	if opts == nil {
+		opts = &EnsureIndexesOptions{}
+	}
+
+	db.mu.RLock()
+	declared := make(map[string][]Index, len(db.indexes))
+	collNames := make([]string, 0, len(db.indexes))
+	for collName, indexes := range db.indexes {
+		declared[collName] = indexes
+		collNames = append(collNames, collName)
+	}
+	db.mu.RUnlock()
+	sort.Strings(collNames)
+
+	for _, collName := range collNames {
+		if err := db.reconcileIndexes(ctx, op, collName, declared[collName], *opts, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+/* Create a unique index over the given fields so that upserts filtering on them cannot insert duplicates.
+ * Creating an index that already exists with the same options is a no-op. */
+func (db *DB) EnsureUniqueIndex(ctx context.Context, collName string, fields ...string) error {
+	const op = "EnsureUniqueIndex"
+	if err := db.check(op); err != nil {
+		return err
+	}
+	index := Index{Keys: fields, Unique: true}
+	if err := index.validate(); err != nil {
+		return newError(op, nil, err)
+	}
+	return db.reconcileIndexes(ctx, op, collName, []Index{index}, EnsureIndexesOptions{}, &IndexReport{})
+}
+
+/* Make sure collName has a TTL index on timeField. It is checked once per process, and again when ttl changes. */
+func (db *DB) ensureTTLIndex(ctx context.Context, op string, collName string, timeField string,
+	ttl time.Duration) error {
+	key := collName + "." + timeField
+	db.mu.RLock()
+	current, ok := db.ttlIndexes[key]
+	db.mu.RUnlock()
+	if ok && current == ttl {
+		return nil
+	}
+
+	index := Index{Keys: []string{timeField}, TTL: ttl, Expire: true}
+	if err := index.validate(); err != nil {
+		return newError(op, nil, err)
+	}
+	if err := db.reconcileIndexes(ctx, op, collName, []Index{index}, EnsureIndexesOptions{}, &IndexReport{}); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ttlIndexes[key] = ttl
+	return nil
+}
+
+/* Reconcile the indexes of collName with indexes and add the changes to report. */
+func (db *DB) reconcileIndexes(ctx context.Context, op string, collName string, indexes []Index,
+	opts EnsureIndexesOptions, report *IndexReport) error {
+	collection := db.collection(collName)
+	existing, err := listIndexes(ctx, collection)
+	if err != nil {
+		return wrapError(op, err)
+	}
+
+	kept := map[string]bool{"_id_": true}
+	for _, index := range indexes {
+		name := index.name()
+		current, found := findIndex(existing, name, index.keySpec())
+		if !found {
+			if _, err := collection.Indexes().CreateOne(ctx, index.model()); err != nil {
+				return wrapError(op, err)
+			}
+			report.Created = append(report.Created, collName+"."+name)
+			kept[name] = true
+			continue
+		}
+		kept[current.Name] = true
+
+		if conflict := index.conflict(current); conflict != "" {
+			if !opts.Rebuild {
+				return newError(op, ErrIndexConflict, fmt.Errorf("index %s.%s: %s", collName, current.Name, conflict))
+			}
+			if _, err := collection.Indexes().DropOne(ctx, current.Name); err != nil {
+				return wrapError(op, err)
+			}
+			if _, err := collection.Indexes().CreateOne(ctx, index.model()); err != nil {
+				return wrapError(op, err)
+			}
+			report.Rebuilt = append(report.Rebuilt, collName+"."+name)
+			kept[name] = true
+			continue
+		}
+
+		if seconds := int64(index.TTL / time.Second); index.ttl() && *current.ExpireAfterSeconds != seconds {
+			err := db.Client.Database(db.Name).RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: collName},
+				{Key: "index", Value: bson.D{
+					{Key: "name", Value: current.Name},
+					{Key: "expireAfterSeconds", Value: seconds},
+				}},
+			}).Err()
+			if err != nil {
+				return wrapError(op, err)
+			}
+			report.Modified = append(report.Modified, collName+"."+current.Name)
+		}
+	}
+
+	if !opts.DropUndeclared {
+		return nil
+	}
+	for _, current := range existing {
+		if kept[current.Name] {
+			continue
+		}
+		if _, err := collection.Indexes().DropOne(ctx, current.Name); err != nil {
+			return wrapError(op, err)
+		}
+		report.Dropped = append(report.Dropped, collName+"."+current.Name)
+	}
+	return nil
+}
+
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]indexInfo, error) {
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		// a collection that does not exist yet has no indexes.
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(26) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var indexes []indexInfo
+	if err := cur.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+/* Find the existing index with the given name, or else with the same keys. */
+func findIndex(existing []indexInfo, name string, keySpec string) (indexInfo, bool) {
+	for _, index := range existing {
+		if index.Name == name {
+			return index, true
+		}
+	}
+	for _, index := range existing {
+		if existingKeySpec(index.Key) == keySpec {
+			return index, true
+		}
+	}
+	return indexInfo{}, false
+}
+
+func (index Index) validate() error {
+	if len(index.Keys) == 0 {
+		return errors.New("index without keys")
+	}
+	for _, key := range index.Keys {
+		if strings.TrimPrefix(key, "-") == "" {
+			return errors.New("empty index key")
+		}
+	}
+	if index.ttl() {
+		if index.TTL < 0 || (index.TTL > 0 && index.TTL < time.Second) {
+			return fmt.Errorf("index %s: ttl must be 0 or at least one second", index.name())
+		}
+		if len(index.Keys) != 1 {
+			return fmt.Errorf("index %s: a ttl index has a single key", index.name())
+		}
+	}
+	return nil
+}
+
+/* Report whether the index is a TTL index. */
+func (index Index) ttl() bool {
+	return index.Expire || index.TTL != 0
+}
+
+func (index Index) keys() bson.D {
+	keys := make(bson.D, 0, len(index.Keys))
+	for _, key := range index.Keys {
+		if strings.HasPrefix(key, "-") {
+			keys = append(keys, bson.E{Key: key[1:], Value: int32(-1)})
+		} else {
+			keys = append(keys, bson.E{Key: key, Value: int32(1)})
+		}
+	}
+	return keys
+}
+
+/* Return the keys in the form of a default index name, "field_1" for each ascending and "field_-1" for each
+ * descending field. */
+func (index Index) keySpec() string {
+	return existingKeySpec(index.keys())
+}
+
+func existingKeySpec(keys bson.D) string {
+	parts := make([]string, 0, len(keys))
+	for _, e := range keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", e.Key, e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (index Index) name() string {
+	if index.Name != "" {
+		return index.Name
+	}
+	return index.keySpec()
+}
+
+func (index Index) model() mongo.IndexModel {
+	opt := options.Index().SetName(index.name())
+	if index.Unique {
+		opt.SetUnique(true)
+	}
+	if index.Sparse {
+		opt.SetSparse(true)
+	}
+	if index.ttl() {
+		opt.SetExpireAfterSeconds(int32(index.TTL / time.Second))
+	}
+	if index.PartialFilter != nil {
+		opt.SetPartialFilterExpression(index.PartialFilter)
+	}
+	return mongo.IndexModel{Keys: index.keys(), Options: opt}
+}
+
+/* Describe how current differs from the declaration in ways collMod cannot change, "" when it does not. */
+func (index Index) conflict(current indexInfo) string {
+	switch {
+	case existingKeySpec(current.Key) != index.keySpec():
+		return fmt.Sprintf("keys %s instead of %s", existingKeySpec(current.Key), index.keySpec())
+	case current.Unique != index.Unique:
+		return fmt.Sprintf("unique is %t", current.Unique)
+	case current.Sparse != index.Sparse:
+		return fmt.Sprintf("sparse is %t", current.Sparse)
+	case (current.ExpireAfterSeconds != nil) != index.ttl():
+		return fmt.Sprintf("ttl index is %t", current.ExpireAfterSeconds != nil)
+	case !sameFilter(current.PartialFilter, index.PartialFilter):
+		return "partial filter differs"
+	}
+	return ""
+}
+
+func sameFilter(a bson.M, b bson.M) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	// relaxed extended JSON does not tell the integer types apart, which the server may store differently.
+	jsonA, errA := bson.MarshalExtJSON(canonical(a), false, false)
+	jsonB, errB := bson.MarshalExtJSON(canonical(b), false, false)
+	return errA == nil && errB == nil && string(jsonA) == string(jsonB)
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/* Iterator walks the documents of a query one at a time, so only the current batch is held in memory.
+ * Always Close it, ForEach does that for you. */
+type Iterator struct {
+	ctx context.Context
+	op  string
+	cur *mongo.Cursor
+	err error
+}
+
+/* Open an iterator over the documents matching filter. opts may be nil; Sort is only applied when set, and
+ * BatchSize tunes the number of documents fetched per round trip. */
+func (db *DB) Iterate(ctx context.Context, collName string, filter bson.M, opts *QueryOptions) (*Iterator, error) {
+	const op = "Iterate"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+	var sortKeys bson.D
+	if len(opts.Sort) > 0 || opts.PageToken != "" {
+		sortKeys = normalizeSort(opts.Sort)
+	}
+	if !opts.IncludeDeleted {
+		var err error
+		if filter, err = db.readFilter(ctx, collName, filter); err != nil {
+			return nil, wrapError(op, err)
+		}
+	}
+	filter, findOpt, err := buildFind(filter, opts, sortKeys)
+	if err != nil {
+		return nil, newError(op, ErrInvalidPageToken, err)
+	}
+
+	cur, err := db.collection(collName).Find(ctx, filter, findOpt)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	return &Iterator{ctx: ctx, op: op, cur: cur}, nil
+}
+
+/* Advance to the next document. It returns false at the end of the results, on error and once the context is
+ * done; check Err afterwards. */
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = wrapError(it.op, err)
+		return false
+	}
+	if it.cur.Next(it.ctx) {
+		return true
+	}
+	it.err = wrapError(it.op, it.cur.Err())
+	return false
+}
+
+/* Decode the current document into v, which can be a map or a pointer to a struct. */
+func (it *Iterator) Decode(v interface{}) error {
+	if err := it.cur.Decode(v); err != nil {
+		return wrapError(it.op, err)
+	}
+	stripRevision(v)
+	return nil
+}
+
+/* Return the current document without decoding it. */
+func (it *Iterator) Current() bson.Raw {
+	return it.cur.Current
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Close() error {
+	// the iterator context may already be cancelled, closing must still reach the server.
+	return wrapError(it.op, it.cur.Close(context.Background()))
+}
+
+/* Call fn for every document matching filter until fn returns an error, the context is done or the results are
+ * exhausted. fn decodes the document itself through it.Decode. */
+func (db *DB) ForEach(ctx context.Context, collName string, filter bson.M, opts *QueryOptions,
+	fn func(it *Iterator) error) error {
+	it, err := db.Iterate(ctx, collName, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
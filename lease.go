@@ -0,0 +1,382 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+const defaultLeaseDuration = 30 * time.Second
+
+/* LeaseOptions tunes AcquireChunkLease. */
+type LeaseOptions struct {
+	// Duration is how long a chunk stays owned without renewal, default 30s. Clocks of the instances sharing the
+	// pool must differ by much less.
+	Duration time.Duration
+	// RenewInterval is how often the heartbeat renews the lease, default a third of Duration.
+	RenewInterval time.Duration
+	// Owner names the owner in the chunk document, default $HOSTNAME.
+	Owner string
+	// ManualRenew turns the heartbeat off, the caller then renews the lease with Renew in time.
+	ManualRenew bool
+}
+
+/* ChunkLease is the ownership of a chunk of a chunk pool for a limited time. A background heartbeat renews it until
+ * Release is called. When it can no longer be renewed, because it expired and another instance took the chunk
+ * over, Lost is closed and the ids of the chunk must not be handed out anymore.
+ *
+ * Token is the fencing token of the lease: it grows with every handoff of the chunk, so storing it with the records
+ * created under the lease, or matching it in their write filters, lets a stale owner's writes be told apart. */
+type ChunkLease struct {
+	Pool  string
+	Chunk int32
+	Lower int32
+	Upper int32
+	Token int64
+
+	db       *DB
+	owner    string
+	duration time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu      sync.Mutex
+	expires time.Time
+	err     error
+	lost    chan struct{}
+}
+
+/* Take a free or expired chunk of the chunk pool poolName and, unless opts.ManualRenew is set, start renewing its
+ * lease in the background. */
+func (db *DB) AcquireChunkLease(ctx context.Context, poolName string, opts *LeaseOptions) (*ChunkLease, error) {
+	const op = "AcquireChunkLease"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	pool, err := db.pool(ctx, op, poolName, StrategyChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &ChunkLease{
+		Pool:     poolName,
+		db:       db,
+		owner:    os.Getenv("HOSTNAME"),
+		duration: defaultLeaseDuration,
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	interval, heartbeat := time.Duration(0), true
+	if opts != nil {
+		if opts.Duration > 0 {
+			lease.duration = opts.Duration
+		}
+		if opts.Owner != "" {
+			lease.owner = opts.Owner
+		}
+		interval = opts.RenewInterval
+		heartbeat = !opts.ManualRenew
+	}
+	if interval <= 0 || interval >= lease.duration {
+		interval = lease.duration / 3
+	}
+
+	totalChunks := (pool.Max - pool.Min) / pool.ChunkSize
+	for i := 0; i < pool.Retries; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, wrapError(op, err)
+		}
+		claimed, err := lease.claim(ctx, rand.Intn(totalChunks), pool)
+		if err != nil {
+			return nil, wrapError(op, err)
+		}
+		if claimed {
+			lease.start(interval, heartbeat)
+			return lease, nil
+		}
+	}
+
+	// the random picks collided, look for the free chunks in order.
+	for chunk := 0; ; chunk++ {
+		chunk, err = db.firstFree(ctx, poolName, chunk, totalChunks, heldChunks())
+		if err != nil {
+			return nil, wrapError(op, err)
+		}
+		if chunk == totalChunks {
+			err := fmt.Errorf("all %d chunks of %s are leased", totalChunks, poolName)
+			return nil, newError(op, ErrPoolExhausted, err)
+		}
+		claimed, err := lease.claim(ctx, chunk, pool)
+		if err != nil {
+			return nil, wrapError(op, err)
+		}
+		if claimed {
+			lease.start(interval, heartbeat)
+			return lease, nil
+		}
+	}
+}
+
+/* Try to take the given chunk of pool for the lease. */
+func (l *ChunkLease) claim(ctx context.Context, chunk int, pool poolMetadata) (bool, error) {
+	lower := pool.Min + chunk*pool.ChunkSize
+	expires := time.Now().Add(l.duration)
+	token, claimed, err := l.db.claimChunk(ctx, l.Pool, chunk, lower, lower+pool.ChunkSize, l.owner, expires)
+	if err != nil || !claimed {
+		return false, err
+	}
+	l.Chunk, l.Lower, l.Upper = int32(chunk), int32(lower), int32(lower+pool.ChunkSize)
+	l.Token, l.expires = token, expires
+	logger.MongoDBLog.Println("Leased chunk #", chunk, "with token", token, "until", expires)
+	return true, nil
+}
+
+/* Start renewing the claimed lease in the background, unless heartbeat is false. */
+func (l *ChunkLease) start(interval time.Duration, heartbeat bool) {
+	heartbeatCtx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	if heartbeat {
+		go l.heartbeat(heartbeatCtx, interval)
+	} else {
+		close(l.done)
+	}
+}
+
+/* Extend the lease by its duration. It fails with ErrLeaseLost once another instance took the chunk over. */
+func (l *ChunkLease) Renew(ctx context.Context) error {
+	const op = "ChunkLease.Renew"
+	if err := l.Err(); err != nil {
+		return err
+	}
+	expires := time.Now().Add(l.duration)
+	result, err := l.db.collection(l.Pool).UpdateOne(ctx, bson.M{"_id": l.Chunk, "token": l.Token},
+		bson.M{"$set": bson.M{"expiresAt": expires}})
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if result.MatchedCount == 0 {
+		err := newError(op, ErrLeaseLost, nil)
+		l.fail(err)
+		return err
+	}
+	l.mu.Lock()
+	l.expires = expires
+	l.mu.Unlock()
+	return nil
+}
+
+/* Stop renewing the lease and free the chunk, unless it was already taken over, which fails with ErrLeaseLost. */
+func (l *ChunkLease) Release(ctx context.Context) error {
+	const op = "ChunkLease.Release"
+	l.cancel()
+	<-l.done
+	if err := l.Err(); err != nil {
+		return err
+	}
+	released, err := l.db.releaseChunk(ctx, l.Pool, bson.M{"_id": l.Chunk, "token": l.Token})
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if !released {
+		return newError(op, ErrLeaseLost, nil)
+	}
+	l.fail(newError(op, ErrLeaseLost, errors.New("lease was released")))
+	return nil
+}
+
+/* Report whether the lease is held: it was not lost and did not expire since its last renewal. */
+func (l *ChunkLease) Valid() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err == nil && time.Now().Before(l.expires)
+}
+
+/* Lost is closed once the lease is lost or released. */
+func (l *ChunkLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+/* Return why the lease was lost, nil while it is held. */
+func (l *ChunkLease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *ChunkLease) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+		close(l.lost)
+	}
+}
+
+/* Renew the lease every interval until ctx is done or the lease is lost. */
+func (l *ChunkLease) heartbeat(ctx context.Context, interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewCtx, cancel := context.WithTimeout(ctx, interval)
+		err := l.Renew(renewCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		if errors.Is(err, ErrLeaseLost) {
+			logger.MongoDBLog.Warnln("lost the lease of chunk", l.Chunk, "of", l.Pool)
+			return
+		}
+		logger.MongoDBLog.Warnln("renewing the lease of chunk", l.Chunk, "of", l.Pool, "failed:", err)
+		if !l.Valid() {
+			// another instance may take the chunk over from now on.
+			l.fail(newError("ChunkLease.Renew", ErrLeaseLost, errors.New("lease expired")))
+			return
+		}
+	}
+}
+
+/* chunkKey identifies a chunk of a pool. */
+type chunkKey struct {
+	pool  string
+	chunk int
+}
+
+/* ownChunk is a chunk taken with claimOwnChunk. */
+type ownChunk struct {
+	token int64
+	// releasing is set while the chunk is being released, it is not renewed meanwhile.
+	releasing bool
+}
+
+/* Claim a chunk for this process, see GetChunkFromPool. It is leased for Options.ChunkLease and renewed in the
+ * background until it is released with ReleaseChunkToPool. */
+func (db *DB) claimOwnChunk(ctx context.Context, poolName string, chunk int, lower int, upper int) (bool, error) {
+	expires := time.Now().Add(db.opts.ChunkLease)
+	token, claimed, err := db.claimChunk(ctx, poolName, chunk, lower, upper, os.Getenv("HOSTNAME"), expires)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ownChunks[chunkKey{poolName, chunk}] = ownChunk{token: token}
+	if !db.renewing {
+		db.renewing = true
+		go db.renewChunks()
+	}
+	return true, nil
+}
+
+/* Free a chunk taken with claimOwnChunk, matching it by its fencing token, and stop renewing it. It reports false
+ * when db does not hold the chunk, or lost it to another instance, which renewChunks then notices. */
+func (db *DB) releaseOwnChunk(ctx context.Context, poolName string, chunk int) (bool, error) {
+	key := chunkKey{poolName, chunk}
+	db.mu.Lock()
+	own, ok := db.ownChunks[key]
+	if ok {
+		own.releasing = true
+		db.ownChunks[key] = own
+	}
+	db.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	released, err := db.releaseChunk(ctx, poolName, bson.M{"_id": chunk, "token": own.token})
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	current, ok := db.ownChunks[key]
+	if !ok || current.token != own.token {
+		return released, err
+	}
+	if err != nil || !released {
+		current.releasing = false
+		db.ownChunks[key] = current
+		return false, err
+	}
+	delete(db.ownChunks, key)
+	return true, nil
+}
+
+/* Renew the leases of the chunks taken with claimOwnChunk until none is left. A chunk whose lease could not be
+ * renewed in time may have been taken over, which is logged since the callers of GetChunkFromPool cannot be
+ * told. */
+func (db *DB) renewChunks() {
+	interval := db.opts.ChunkLease / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	owner := os.Getenv("HOSTNAME")
+	for range ticker.C {
+		db.mu.Lock()
+		if len(db.ownChunks) == 0 {
+			db.renewing = false
+			db.mu.Unlock()
+			return
+		}
+		chunks := make(map[chunkKey]int64, len(db.ownChunks))
+		for key, own := range db.ownChunks {
+			if !own.releasing {
+				chunks[key] = own.token
+			}
+		}
+		db.mu.Unlock()
+
+		for key, token := range chunks {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			result, err := db.collection(key.pool).UpdateOne(ctx,
+				bson.M{"_id": key.chunk, "token": token, "owner": owner},
+				bson.M{"$set": bson.M{"expiresAt": time.Now().Add(db.opts.ChunkLease)}})
+			cancel()
+			if err != nil {
+				logger.MongoDBLog.Warnln("renewing chunk", key.chunk, "of", key.pool, "failed:", err)
+				continue
+			}
+			if result.MatchedCount == 0 {
+				db.mu.Lock()
+				if own := db.ownChunks[key]; own.token == token && !own.releasing {
+					delete(db.ownChunks, key)
+					logger.MongoDBLog.Errorln("lost chunk", key.chunk, "of", key.pool, "to another instance")
+				}
+				db.mu.Unlock()
+			}
+		}
+	}
+}
+
+/* Lease the chunks of poolName that were claimed before chunks had leases, and so would stay held for good, for
+ * Options.ChunkLease from now and return how many there were. Run it once after every instance using the pool
+ * runs this version: the processes that claimed such chunks are gone by then, and their chunks can be taken over
+ * once the lease expires. */
+func (db *DB) MigrateChunkPool(ctx context.Context, poolName string) (int64, error) {
+	const op = "MigrateChunkPool"
+	if err := db.check(op); err != nil {
+		return 0, err
+	}
+	result, err := db.collection(poolName).UpdateMany(ctx, bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"expiresAt": time.Now().Add(db.opts.ChunkLease)}})
+	if err != nil {
+		return 0, wrapError(op, err)
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,346 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+const defaultPrefetchThreshold = 0.8
+
+var errAllocatorClosed = errors.New("allocator is closed")
+
+/* LocalAllocator hands out single ids from chunks of a chunk pool it holds, in memory and without a round trip to
+ * the database. It takes the next chunk from the pool in the background once the share of the held ids in use
+ * crosses the prefetch threshold, and gives a chunk back with ReleaseChunkToPool once all of its ids were released,
+ * keeping at least one chunk.
+ *
+ * The ids in use are only known to the instance, so a restarted instance does not hand out the ids of the chunks
+ * it held before. Like other chunks taken with GetChunkFromPool they are renewed while the process runs, and can
+ * be taken over once their lease expired after it stopped. */
+type LocalAllocator struct {
+	allocator
+	threshold float64
+
+	mu   sync.Mutex
+	held []*localChunk
+	// fetching is closed when the running fetch of a chunk completes, nil while none runs.
+	fetching chan struct{}
+	// noPrefetch is set when a prefetch failed, until the held chunks change.
+	noPrefetch bool
+	closed     bool
+}
+
+/* localChunk tracks the ids of a held chunk. */
+type localChunk struct {
+	number int32
+	lower  int32
+	// free is a stack of the ids not in use. It starts with the lowest on top, released ids are pushed on top so
+	// they are handed out again first.
+	free  []int32
+	inUse []bool
+}
+
+/* Return a LocalAllocator over the chunk pool poolName, holding a first chunk of it. prefetchThreshold is the share
+ * of the held ids in use from which the next chunk is fetched, values outside (0, 1] select the default of 0.8. */
+func (db *DB) NewLocalAllocator(ctx context.Context, poolName string, prefetchThreshold float64) (*LocalAllocator,
+	error) {
+	const op = "NewLocalAllocator"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	pool, err := db.pool(ctx, op, poolName, StrategyChunk)
+	if err != nil {
+		return nil, err
+	}
+	if prefetchThreshold <= 0 || prefetchThreshold > 1 {
+		prefetchThreshold = defaultPrefetchThreshold
+	}
+
+	a := &LocalAllocator{
+		allocator: allocator{db: db, cfg: AllocatorConfig{
+			Strategy:  StrategyChunk,
+			Name:      poolName,
+			Min:       int32(pool.Min),
+			Max:       int32(pool.Max),
+			Retries:   pool.Retries,
+			ChunkSize: int32(pool.ChunkSize),
+		}},
+		threshold: prefetchThreshold,
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.fetch(ctx); err != nil {
+		return nil, wrapError(op, err)
+	}
+	return a, nil
+}
+
+func (a *LocalAllocator) Allocate(ctx context.Context) (int32, error) {
+	const op = "LocalAllocator.Allocate"
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for {
+		if a.closed {
+			return -1, newError(op, nil, errAllocatorClosed)
+		}
+		for _, chunk := range a.held {
+			if id, ok := chunk.take(); ok {
+				a.prefetch()
+				return id, nil
+			}
+		}
+
+		// all held ids are in use: wait for the running fetch, or fetch a chunk now.
+		if fetching := a.fetching; fetching != nil {
+			a.mu.Unlock()
+			select {
+			case <-fetching:
+			case <-ctx.Done():
+			}
+			a.mu.Lock()
+			if err := ctx.Err(); err != nil {
+				return -1, wrapError(op, err)
+			}
+			continue
+		}
+		if err := a.fetch(ctx); err != nil {
+			return -1, wrapError(op, err)
+		}
+	}
+}
+
+/* Release makes id free again. Once all ids of its chunk are free, the chunk goes back to the pool unless it is the
+ * last one held. Releasing an id of a chunk that is not held has no effect. */
+func (a *LocalAllocator) Release(ctx context.Context, id int32) error {
+	const op = "LocalAllocator.Release"
+	if err := a.checkRange(op, id); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := a.chunkIndex(id)
+	if i < 0 {
+		return nil
+	}
+	chunk := a.held[i]
+	chunk.put(id)
+	if len(chunk.free) < len(chunk.inUse) || len(a.held) == 1 {
+		return nil
+	}
+
+	// the chunk is no longer handed out from while it goes back to the pool.
+	a.held = append(a.held[:i], a.held[i+1:]...)
+	a.mu.Unlock()
+	err := a.db.ReleaseChunkToPoolWithContext(ctx, a.cfg.Name, chunk.number)
+	a.mu.Lock()
+	if err != nil {
+		a.held = append(a.held, chunk)
+		return wrapError(op, err)
+	}
+	a.noPrefetch = false
+	logger.MongoDBLog.Println("Returned free chunk #", chunk.number, "of", a.cfg.Name)
+	return nil
+}
+
+/* Reserve marks id in use, taking its chunk from the pool when it is not held. An id of a chunk held by another
+ * instance fails with ErrAlreadyAllocated. */
+func (a *LocalAllocator) Reserve(ctx context.Context, id int32) error {
+	const op = "LocalAllocator.Reserve"
+	if err := a.checkRange(op, id); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return newError(op, nil, errAllocatorClosed)
+	}
+	if i := a.chunkIndex(id); i >= 0 {
+		if !a.held[i].reserve(id) {
+			return newError(op, ErrAlreadyAllocated, nil)
+		}
+		return nil
+	}
+
+	number := a.chunkOf(id)
+	lower, upper := a.cfg.ChunkRange(number)
+	a.mu.Unlock()
+	claimed, err := a.db.claimOwnChunk(ctx, a.cfg.Name, int(number), int(lower), int(upper))
+	a.mu.Lock()
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if !claimed {
+		return newError(op, ErrAlreadyAllocated, nil)
+	}
+	if a.closed {
+		// Close no longer sees the chunk, give it back.
+		a.mu.Unlock()
+		err := a.db.ReleaseChunkToPoolWithContext(ctx, a.cfg.Name, number)
+		a.mu.Lock()
+		if err != nil {
+			return wrapError(op, err)
+		}
+		return newError(op, nil, errAllocatorClosed)
+	}
+	chunk := a.addChunk(number, lower)
+	chunk.reserve(id)
+	return nil
+}
+
+/* Stats counts the ids of the chunks held by other instances as allocated. */
+func (a *LocalAllocator) Stats(ctx context.Context) (AllocatorStats, error) {
+	const op = "LocalAllocator.Stats"
+	taken, err := a.db.collection(a.cfg.Name).CountDocuments(ctx, heldChunks())
+	if err != nil {
+		return AllocatorStats{}, wrapError(op, err)
+	}
+	a.mu.Lock()
+	free := (int64(a.chunks()) - taken) * int64(a.cfg.ChunkSize)
+	for _, chunk := range a.held {
+		free += int64(len(chunk.free))
+	}
+	a.mu.Unlock()
+	return a.stats(a.capacity() - free), nil
+}
+
+/* Close stops the allocator and returns the chunks with no id in use to the pool. The other chunks stay held, their
+ * ids being still in use. */
+func (a *LocalAllocator) Close(ctx context.Context) error {
+	const op = "LocalAllocator.Close"
+	a.mu.Lock()
+	a.closed = true
+	for a.fetching != nil {
+		fetching := a.fetching
+		a.mu.Unlock()
+		<-fetching
+		a.mu.Lock()
+	}
+	var free []int32
+	for _, chunk := range a.held {
+		if len(chunk.free) == len(chunk.inUse) {
+			free = append(free, chunk.number)
+		}
+	}
+	a.held = nil
+	a.mu.Unlock()
+
+	for _, number := range free {
+		if err := a.db.ReleaseChunkToPoolWithContext(ctx, a.cfg.Name, number); err != nil {
+			return wrapError(op, err)
+		}
+	}
+	return nil
+}
+
+/* Take a chunk from the pool and add it to the held ones. a.mu is held on entry and on return, but not while the
+ * database is queried. */
+func (a *LocalAllocator) fetch(ctx context.Context) error {
+	fetching := make(chan struct{})
+	a.fetching = fetching
+	a.mu.Unlock()
+	number, lower, _, err := a.db.GetChunkFromPoolWithContext(ctx, a.cfg.Name)
+	a.mu.Lock()
+	a.fetching = nil
+	close(fetching)
+	if err != nil {
+		return err
+	}
+	a.addChunk(number, lower)
+	a.noPrefetch = false
+	return nil
+}
+
+/* Start fetching the next chunk in the background when the share of the held ids in use crosses the threshold.
+ * a.mu is held. */
+func (a *LocalAllocator) prefetch() {
+	if a.fetching != nil || a.noPrefetch || a.closed {
+		return
+	}
+	var size, free int
+	for _, chunk := range a.held {
+		size += len(chunk.inUse)
+		free += len(chunk.free)
+	}
+	if float64(size-free) < a.threshold*float64(size) {
+		return
+	}
+	fetching := make(chan struct{})
+	a.fetching = fetching
+	go func() {
+		number, lower, _, err := a.db.GetChunkFromPoolWithContext(context.Background(), a.cfg.Name)
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.fetching = nil
+		close(fetching)
+		if err != nil {
+			logger.MongoDBLog.Warnln("prefetching a chunk of", a.cfg.Name, "failed:", err)
+			a.noPrefetch = true
+			return
+		}
+		a.addChunk(number, lower)
+	}()
+}
+
+func (a *LocalAllocator) addChunk(number int32, lower int32) *localChunk {
+	chunk := &localChunk{
+		number: number,
+		lower:  lower,
+		free:   make([]int32, a.cfg.ChunkSize),
+		inUse:  make([]bool, a.cfg.ChunkSize),
+	}
+	for i := range chunk.free {
+		chunk.free[i] = lower + a.cfg.ChunkSize - 1 - int32(i)
+	}
+	a.held = append(a.held, chunk)
+	return chunk
+}
+
+/* Return the index of the held chunk containing id, -1 when it is not held. */
+func (a *LocalAllocator) chunkIndex(id int32) int {
+	for i, chunk := range a.held {
+		if id >= chunk.lower && id < chunk.lower+int32(len(chunk.inUse)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *localChunk) take() (int32, bool) {
+	if len(c.free) == 0 {
+		return -1, false
+	}
+	id := c.free[len(c.free)-1]
+	c.free = c.free[:len(c.free)-1]
+	c.inUse[id-c.lower] = true
+	return id, true
+}
+
+func (c *localChunk) put(id int32) {
+	if c.inUse[id-c.lower] {
+		c.inUse[id-c.lower] = false
+		c.free = append(c.free, id)
+	}
+}
+
+/* Mark the free id in use, false when it is in use already. */
+func (c *localChunk) reserve(id int32) bool {
+	if c.inUse[id-c.lower] {
+		return false
+	}
+	for i, free := range c.free {
+		if free == id {
+			c.free = append(c.free[:i], c.free[i+1:]...)
+			break
+		}
+	}
+	c.inUse[id-c.lower] = true
+	return true
+}
@@ -0,0 +1,628 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Merge patches (RFC 7386) and JSON patches (RFC 6902) are applied directly to the decoded BSON document instead of
+// a JSON copy of it, so values the patch does not touch keep their BSON type. Values written by the patch take the
+// type of the value they replace where possible: a JSON number replacing an int32 stays an int32, an RFC 3339
+// string replacing a date stays a date and a hex string replacing an ObjectID stays an ObjectID.
+
+var errTestFailed = errors.New("test failed")
+
+/* One operation of a JSON patch. */
+type patchOperation struct {
+	Op       string
+	Path     []string
+	From     []string
+	Value    interface{}
+	HasValue bool
+}
+
+/* Decode a JSON patch document. Numbers are kept as json.Number until their target type is known. */
+func decodeJSONPatch(patchJSON []byte) ([]patchOperation, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(patchJSON, &raw); err != nil {
+		return nil, err
+	}
+
+	operations := make([]patchOperation, 0, len(raw))
+	for i, fields := range raw {
+		var operation patchOperation
+		if err := json.Unmarshal(fields["op"], &operation.Op); err != nil {
+			return nil, fmt.Errorf("operation %d: missing op", i)
+		}
+		var path string
+		if err := json.Unmarshal(fields["path"], &path); err != nil {
+			return nil, fmt.Errorf("operation %d: missing path", i)
+		}
+		var err error
+		if operation.Path, err = parsePointer(path); err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+
+		switch operation.Op {
+		case "add", "replace", "test":
+			value, ok := fields["value"]
+			if !ok {
+				return nil, fmt.Errorf("operation %d: %s needs a value", i, operation.Op)
+			}
+			if operation.Value, err = decodeJSONValue(value); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", i, err)
+			}
+			operation.HasValue = true
+		case "move", "copy":
+			var from string
+			if err := json.Unmarshal(fields["from"], &from); err != nil {
+				return nil, fmt.Errorf("operation %d: %s needs from", i, operation.Op)
+			}
+			if operation.From, err = parsePointer(from); err != nil {
+				return nil, fmt.Errorf("operation %d: %v", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, operation.Op)
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+func decodeJSONValue(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+/* Split a JSON pointer (RFC 6901) into its unescaped reference tokens. */
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+/* Parse the location of a subtree, given as a JSON pointer or as a dotted path. */
+func parseDataPath(dataName string) ([]string, error) {
+	if strings.HasPrefix(dataName, "/") {
+		return parsePointer(dataName)
+	}
+	if dataName == "" {
+		return nil, errors.New("empty path")
+	}
+	return strings.Split(dataName, "."), nil
+}
+
+/* Turn path into the dotted form used by update operators, array indexes included. */
+func dottedPath(path []string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("path must not point at the whole document")
+	}
+	for _, token := range path {
+		if token == "" || strings.Contains(token, ".") || strings.HasPrefix(token, "$") {
+			return "", fmt.Errorf("%q cannot be used in an update path", token)
+		}
+	}
+	return strings.Join(path, "."), nil
+}
+
+/* Apply operations in order to doc, which must be normalized. */
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	var err error
+	for i, operation := range operations {
+		switch operation.Op {
+		case "add":
+			doc, err = patchAdd(doc, operation.Path, operation.Value, false)
+		case "replace":
+			doc, err = patchAdd(doc, operation.Path, operation.Value, true)
+		case "remove":
+			doc, _, err = patchRemove(doc, operation.Path)
+		case "move":
+			if isPrefix(operation.From, operation.Path) && len(operation.From) < len(operation.Path) {
+				err = errors.New("cannot move a value into one of its children")
+				break
+			}
+			var value interface{}
+			if doc, value, err = patchRemove(doc, operation.From); err == nil {
+				doc, err = patchAdd(doc, operation.Path, value, false)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = patchGet(doc, operation.From); err == nil {
+				doc, err = patchAdd(doc, operation.Path, deepCopy(value), false)
+			}
+		case "test":
+			// a missing path fails the test like a different value.
+			if value, getErr := patchGet(doc, operation.Path); getErr != nil {
+				err = fmt.Errorf("%w: %v", errTestFailed, getErr)
+			} else if !valuesEqual(value, operation.Value) {
+				err = errTestFailed
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, formatPointer(operation.Path), err)
+		}
+	}
+	return doc, nil
+}
+
+/* Translate the test operations of a patch into query predicates, so that the update only matches while the tested
+ * values are unchanged. Only tests of paths that no earlier operation modified test the stored document, later ones
+ * test intermediate results and are checked in memory only. The predicates use the raw stored values, which keeps
+ * the field order of embedded documents. prefix is the location the patch paths are relative to. */
+func testConditions(operations []patchOperation, prefix []string, raw bson.Raw) bson.M {
+	conditions := bson.M{}
+	var modified [][]string
+	for _, operation := range operations {
+		switch operation.Op {
+		case "test":
+		case "copy":
+			modified = append(modified, operation.Path)
+			continue
+		case "move":
+			modified = append(modified, operation.From, operation.Path)
+			continue
+		default:
+			modified = append(modified, operation.Path)
+			continue
+		}
+
+		touched := false
+		for _, path := range modified {
+			if isPrefix(path, operation.Path) || isPrefix(operation.Path, path) {
+				touched = true
+				break
+			}
+		}
+		path := append(append([]string{}, prefix...), operation.Path...)
+		field, err := dottedPath(path)
+		if touched || err != nil || path[0] == "_id" || path[0] == revisionField {
+			continue
+		}
+		if value, err := raw.LookupErr(path...); err == nil {
+			conditions[field] = value
+		}
+	}
+	return conditions
+}
+
+/* Store value at path. With replace set the location must already exist, as required by the replace op. */
+func patchAdd(node interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return coerce(value, node), nil
+	}
+	key := path[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		old, exists := n[key]
+		if len(path) == 1 {
+			if replace && !exists {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			n[key] = coerce(value, old)
+			return n, nil
+		}
+		if !exists {
+			return nil, fmt.Errorf("member %q does not exist", key)
+		}
+		child, err := patchAdd(old, path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = child
+		return n, nil
+	case []interface{}:
+		if len(path) == 1 && !replace {
+			if key == "-" {
+				return append(n, coerce(value, nil)), nil
+			}
+			idx, err := arrayIndex(key, len(n)+1)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = coerce(value, nil)
+			return n, nil
+		}
+		idx, err := arrayIndex(key, len(n))
+		if err != nil {
+			return nil, err
+		}
+		child, err := patchAdd(n[idx], path[1:], value, replace)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot descend into %T at %q", node, key)
+}
+
+/* Remove the value at path and return the modified node and the removed value. */
+func patchRemove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	key := path[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		old, exists := n[key]
+		if !exists {
+			return nil, nil, fmt.Errorf("member %q does not exist", key)
+		}
+		if len(path) == 1 {
+			delete(n, key)
+			return n, old, nil
+		}
+		child, removed, err := patchRemove(old, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[key] = child
+		return n, removed, nil
+	case []interface{}:
+		idx, err := arrayIndex(key, len(n))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := n[idx]
+			return append(n[:idx], n[idx+1:]...), removed, nil
+		}
+		child, removed, err := patchRemove(n[idx], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[idx] = child
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("cannot descend into %T at %q", node, key)
+}
+
+/* Return the value at path. */
+func patchGet(node interface{}, path []string) (interface{}, error) {
+	for _, key := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, exists := n[key]
+			if !exists {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			node = value
+		case []interface{}:
+			idx, err := arrayIndex(key, len(n))
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T at %q", node, key)
+		}
+	}
+	return node, nil
+}
+
+/* Parse an array index token, which must be below limit. */
+func arrayIndex(token string, limit int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx >= limit || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatPointer(path []string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+/* Apply a merge patch (RFC 7386) to target, which must be normalized. */
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return coerce(patch, target)
+	}
+	targetMap, ok := target.(map[string]interface{})
+	if !ok {
+		targetMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(targetMap, key)
+			continue
+		}
+		targetMap[key] = applyMergePatch(targetMap[key], value)
+	}
+	return targetMap
+}
+
+/* Return the $set and $unset operators that turn original into modified, so that the stored document is exactly
+ * the patch result. raw is the stored document, whose field order the written documents keep. */
+func diffUpdate(original, modified map[string]interface{}, raw bson.Raw) (primitive.M, error) {
+	// _id is immutable and the revision is maintained by the library, a patch cannot write them.
+	delete(modified, "_id")
+	delete(modified, revisionField)
+	set, unset := map[string]interface{}{}, map[string]interface{}{}
+	if err := diffDocuments(nil, original, modified, raw, set, unset); err != nil {
+		return nil, err
+	}
+	update := primitive.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+/* Fill set and unset with the $set and $unset operands that turn original, the document at path, into modified.
+ * Nested documents are compared member by member so that only the changed paths are written, arrays are always
+ * written as a whole. A changed top level member whose name cannot be used in an update path fails. */
+func diffDocuments(path []string, original, modified map[string]interface{}, raw bson.Raw,
+	set, unset map[string]interface{}) error {
+	for key := range original {
+		if _, ok := modified[key]; !ok {
+			field, err := dottedPath(append(append([]string{}, path...), key))
+			if err != nil {
+				return err
+			}
+			unset[field] = ""
+		}
+	}
+	for key, value := range modified {
+		old, ok := original[key]
+		if ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		memberPath := append(append([]string{}, path...), key)
+		field, err := dottedPath(memberPath)
+		if err != nil {
+			return err
+		}
+		oldMap, oldIsMap := old.(map[string]interface{})
+		newMap, newIsMap := value.(map[string]interface{})
+		if oldIsMap && newIsMap && addressable(oldMap) && addressable(newMap) {
+			if err := diffDocuments(memberPath, oldMap, newMap, raw, set, unset); err != nil {
+				return err
+			}
+			continue
+		}
+		stored, _ := raw.LookupErr(memberPath...)
+		set[field] = ordered(value, stored)
+	}
+	return nil
+}
+
+/* Convert the documents in value, which must be normalized, to primitive.D. Members keep the order they have in
+ * stored, the value they replace, and new members follow sorted by name. */
+func ordered(value interface{}, stored bson.RawValue) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var elements []bson.RawElement
+		if doc, ok := stored.DocumentOK(); ok {
+			elements, _ = doc.Elements()
+		}
+		result := make(primitive.D, 0, len(v))
+		kept := map[string]bool{}
+		for _, element := range elements {
+			if child, ok := v[element.Key()]; ok {
+				result = append(result, primitive.E{Key: element.Key(), Value: ordered(child, element.Value())})
+				kept[element.Key()] = true
+			}
+		}
+		added := make([]string, 0, len(v)-len(result))
+		for key := range v {
+			if !kept[key] {
+				added = append(added, key)
+			}
+		}
+		sort.Strings(added)
+		for _, key := range added {
+			result = append(result, primitive.E{Key: key, Value: ordered(v[key], bson.RawValue{})})
+		}
+		return result
+	case []interface{}:
+		var values []bson.RawValue
+		if array, ok := stored.ArrayOK(); ok {
+			values, _ = array.Values()
+		}
+		result := make(primitive.A, len(v))
+		for i, child := range v {
+			var like bson.RawValue
+			if i < len(values) {
+				like = values[i]
+			}
+			result[i] = ordered(child, like)
+		}
+		return result
+	}
+	return value
+}
+
+/* Report whether every member of doc can be named in a dotted path. */
+func addressable(doc map[string]interface{}) bool {
+	for key := range doc {
+		if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+/* Convert primitive.M, primitive.D and primitive.A nodes to plain maps and slices so that the patch functions only
+ * deal with two container types. Leaf values are left alone. */
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.M:
+		return normalize(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			result[key] = normalize(child)
+		}
+		return result
+	case primitive.D:
+		result := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			result[e.Key] = normalize(e.Value)
+		}
+		return result
+	case primitive.A:
+		return normalize([]interface{}(v))
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			result[i] = normalize(child)
+		}
+		return result
+	}
+	return value
+}
+
+func deepCopy(value interface{}) interface{} {
+	return normalize(value)
+}
+
+/* Convert a value written by a patch to the type of the value it replaces, like. New values only have their JSON
+ * numbers converted: integers to int32 or int64 as the bson codec does for Go ints, everything else to float64.
+ * float64 values stay float64. */
+func coerce(value interface{}, like interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}, primitive.M, primitive.D:
+		likeMap, _ := normalize(like).(map[string]interface{})
+		result := normalize(v).(map[string]interface{})
+		for key, child := range result {
+			result[key] = coerce(child, likeMap[key])
+		}
+		return result
+	case []interface{}, primitive.A:
+		likeSlice, _ := normalize(like).([]interface{})
+		result := normalize(v).([]interface{})
+		for i, child := range result {
+			var likeChild interface{}
+			if i < len(likeSlice) {
+				likeChild = likeSlice[i]
+			}
+			result[i] = coerce(child, likeChild)
+		}
+		return result
+	case json.Number:
+		return coerceNumber(v, like)
+	case float64:
+		// a float64 only becomes an integer to take the type of the value it replaces.
+		switch like.(type) {
+		case int32, int64, primitive.Decimal128:
+			return coerceNumber(json.Number(strconv.FormatFloat(v, 'f', -1, 64)), like)
+		}
+		return v
+	case int, int32, int64:
+		return coerceNumber(json.Number(fmt.Sprint(v)), like)
+	case string:
+		switch like.(type) {
+		case primitive.DateTime:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return primitive.NewDateTimeFromTime(t)
+			}
+		case time.Time:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		case primitive.ObjectID:
+			if id, err := primitive.ObjectIDFromHex(v); err == nil {
+				return id
+			}
+		}
+	}
+	return value
+}
+
+func coerceNumber(n json.Number, like interface{}) interface{} {
+	i, intErr := strconv.ParseInt(n.String(), 10, 64)
+	f, floatErr := n.Float64()
+	if intErr != nil && floatErr == nil && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		// integral values written as floats, such as 2 or 2.0 decoded into a float64.
+		i, intErr = int64(f), nil
+	}
+
+	switch like.(type) {
+	case int32:
+		if intErr == nil && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i)
+		}
+	case int64:
+		if intErr == nil {
+			return i
+		}
+	case float64:
+		if floatErr == nil {
+			return f
+		}
+	case primitive.Decimal128:
+		if d, err := primitive.ParseDecimal128(n.String()); err == nil {
+			return d
+		}
+	}
+
+	if _, literalErr := strconv.ParseInt(n.String(), 10, 64); literalErr == nil {
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i)
+		}
+		return i
+	}
+	if floatErr == nil {
+		return f
+	}
+	return n.String()
+}
+
+/* Compare a stored value with a value from a patch, converting the patch value to the stored type first. */
+func valuesEqual(stored interface{}, value interface{}) bool {
+	return reflect.DeepEqual(normalize(stored), coerce(value, stored))
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// poolMetadataCollection holds the definition of every pool, shared by all instances.
+const poolMetadataCollection = "poolMetadata"
+
+// poolMetadataVersion is the version of the stored pool definitions, raised when their meaning changes.
+const poolMetadataVersion = 1
+
+/* poolMetadata defines a pool. Instances that did not initialize a pool load its definition on first use. */
+type poolMetadata struct {
+	Name      string            `bson:"_id"`
+	Strategy  AllocatorStrategy `bson:"strategy"`
+	Min       int               `bson:"min"`
+	Max       int               `bson:"max"`
+	ChunkSize int               `bson:"chunkSize,omitempty"`
+	Retries   int               `bson:"retries,omitempty"`
+	Version   int               `bson:"version"`
+}
+
+/* Store the definition of a pool, or check it against the stored one when the pool already exists, and add it to
+ * the local registry. Only the number of retries may differ between instances, it does not affect which ids they
+ * hand out, each instance keeps its own. */
+func (db *DB) registerPool(ctx context.Context, op string, pool poolMetadata) error {
+	pool.Version = poolMetadataVersion
+	collection := db.collection(poolMetadataCollection)
+	_, err := collection.InsertOne(ctx, pool)
+	if mongo.IsDuplicateKeyError(err) {
+		var stored poolMetadata
+		if err := collection.FindOne(ctx, bson.M{"_id": pool.Name}).Decode(&stored); err != nil {
+			return wrapError(op, err)
+		}
+		if conflict := pool.conflict(stored); conflict != "" {
+			return newError(op, ErrPoolConflict, fmt.Errorf("pool %s: %s", pool.Name, conflict))
+		}
+	} else if err != nil {
+		return wrapError(op, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.pools[pool.Name] = pool
+	return nil
+}
+
+/* Return the definition of the pool poolName with the given strategy, from the local registry or else from the
+ * metadata collection. */
+func (db *DB) pool(ctx context.Context, op string, poolName string, strategy AllocatorStrategy) (poolMetadata, error) {
+	db.mu.RLock()
+	pool, ok := db.pools[poolName]
+	db.mu.RUnlock()
+
+	if !ok {
+		err := db.collection(poolMetadataCollection).FindOne(ctx, bson.M{"_id": poolName}).Decode(&pool)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err := fmt.Errorf("pool %s has not been initialized yet, initialize it as a %s pool", poolName, strategy)
+			return pool, newError(op, ErrPoolNotFound, err)
+		}
+		if err != nil {
+			return pool, wrapError(op, err)
+		}
+		if pool.Version > poolMetadataVersion {
+			return pool, newError(op, ErrPoolConflict,
+				fmt.Errorf("pool %s is defined by the newer version %d", poolName, pool.Version))
+		}
+		if pool.Retries <= 0 {
+			pool.Retries = defaultAllocatorRetries
+		}
+		db.mu.Lock()
+		db.pools[poolName] = pool
+		db.mu.Unlock()
+	}
+
+	if pool.Strategy != strategy {
+		return pool, newError(op, ErrPoolConflict, fmt.Errorf("pool %s is a %s pool", poolName, pool.Strategy))
+	}
+	return pool, nil
+}
+
+/* Describe how the definition differs from the stored one, "" when they agree. */
+func (pool poolMetadata) conflict(stored poolMetadata) string {
+	switch {
+	case stored.Version > pool.Version:
+		return fmt.Sprintf("defined by the newer version %d", stored.Version)
+	case stored.Strategy != pool.Strategy:
+		return fmt.Sprintf("strategy is %s", stored.Strategy)
+	case stored.Min != pool.Min || stored.Max != pool.Max:
+		return fmt.Sprintf("range is [%d, %d)", stored.Min, stored.Max)
+	case stored.ChunkSize != pool.ChunkSize:
+		return fmt.Sprintf("chunk size is %d", stored.ChunkSize)
+	}
+	return ""
+}
@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* QueryOptions selects, orders and pages the documents returned by RestfulAPIGetPage. */
+type QueryOptions struct {
+	// Limit is the page size, 0 returns every remaining document.
+	Limit int64
+	// Skip drops documents from the start of the first page, it is ignored along with a PageToken since the token
+	// already continues after the skipped documents. Prefer PageToken for deep paging.
+	Skip int64
+	// Sort lists the sort keys by priority, 1 ascending and -1 descending. _id is appended as the last key so that
+	// the order is total and page tokens are stable.
+	Sort bson.D
+	// Projection selects the returned fields. Sort keys are always fetched so that a page token can be built.
+	Projection bson.M
+	// PageToken continues after the last document of the previous page. It is only valid with the same filter
+	// and Sort as the query that returned it.
+	PageToken string
+	// BatchSize is the number of documents fetched per round trip by Iterate and ForEach, 0 uses the server
+	// default.
+	BatchSize int32
+	// IncludeDeleted also returns the tombstones of soft delete collections, see EnableSoftDelete.
+	IncludeDeleted bool
+}
+
+/* Page is one page of results. NextPageToken is empty once the last page has been returned. */
+type Page struct {
+	Items         []map[string]interface{}
+	NextPageToken string
+}
+
+/* Return one page of the documents matching filter. Pages continue from a token using a range query on the sort
+ * keys, so the server never scans the documents of earlier pages. */
+func (db *DB) RestfulAPIGetPage(ctx context.Context, collName string, filter bson.M,
+	opts *QueryOptions) (*Page, error) {
+	const op = "RestfulAPIGetPage"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+	sortKeys := normalizeSort(opts.Sort)
+
+	if !opts.IncludeDeleted {
+		var err error
+		if filter, err = db.readFilter(ctx, collName, filter); err != nil {
+			return nil, wrapError(op, err)
+		}
+	}
+	filter, findOpt, err := buildFind(filter, opts, sortKeys)
+	if err != nil {
+		return nil, newError(op, ErrInvalidPageToken, err)
+	}
+	if opts.Limit > 0 {
+		// one extra document tells whether another page follows.
+		findOpt.SetLimit(opts.Limit + 1)
+	}
+	projection, added := projectionWithKeys(opts.Projection, sortKeys)
+	if projection != nil {
+		findOpt.SetProjection(projection)
+	}
+
+	cur, err := db.collection(collName).Find(ctx, filter, findOpt)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	defer cur.Close(ctx)
+
+	page := &Page{}
+	for cur.Next(ctx) {
+		var result map[string]interface{}
+		if err := cur.Decode(&result); err != nil {
+			return nil, wrapError(op, err)
+		}
+		stripRevision(result)
+		page.Items = append(page.Items, result)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, wrapError(op, err)
+	}
+
+	if opts.Limit > 0 && int64(len(page.Items)) > opts.Limit {
+		page.Items = page.Items[:opts.Limit]
+		last := page.Items[len(page.Items)-1]
+		values := make(bson.A, 0, len(sortKeys))
+		for _, key := range sortKeys {
+			value, _ := lookupPath(last, key.Key)
+			values = append(values, value)
+		}
+		if page.NextPageToken, err = encodePageToken(values); err != nil {
+			return nil, wrapError(op, err)
+		}
+	}
+	for _, item := range page.Items {
+		for _, key := range added {
+			delete(item, key)
+		}
+	}
+	return page, nil
+}
+
+/* Translate opts into a filter and find options. With sortKeys set, the results are sorted on them and a page token
+ * in opts restricts the filter to the documents after it. */
+func buildFind(filter bson.M, opts *QueryOptions, sortKeys bson.D) (bson.M, *options.FindOptions, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	findOpt := options.Find()
+	if len(sortKeys) > 0 {
+		findOpt.SetSort(sortKeys)
+	}
+	if opts.PageToken != "" {
+		after, err := decodePageToken(opts.PageToken, len(sortKeys))
+		if err != nil {
+			return nil, nil, err
+		}
+		filter = bson.M{"$and": bson.A{filter, keysetFilter(sortKeys, after)}}
+	} else if opts.Skip > 0 {
+		findOpt.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpt.SetLimit(opts.Limit)
+	}
+	if len(opts.Projection) > 0 {
+		findOpt.SetProjection(opts.Projection)
+	}
+	if opts.BatchSize > 0 {
+		findOpt.SetBatchSize(opts.BatchSize)
+	}
+	return filter, findOpt, nil
+}
+
+/* Copy sort and make sure it ends with _id. */
+func normalizeSort(sort bson.D) bson.D {
+	keys := bson.D{}
+	for _, key := range sort {
+		if key.Key == "_id" {
+			return append(keys, key)
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, bson.E{Key: "_id", Value: 1})
+}
+
+func descending(key bson.E) bool {
+	switch v := key.Value.(type) {
+	case int:
+		return v < 0
+	case int32:
+		return v < 0
+	case int64:
+		return v < 0
+	case float64:
+		return v < 0
+	}
+	return false
+}
+
+/* Match the documents that sort after values: (k1 > v1) or (k1 = v1 and k2 > v2) or ... */
+func keysetFilter(sortKeys bson.D, values bson.A) bson.M {
+	or := bson.A{}
+	for i, key := range sortKeys {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[sortKeys[j].Key] = values[j]
+		}
+		// null and missing keys sort before any value, but $gt and $lt never match across types, so they are
+		// matched apart. A null equality above also matches missing keys.
+		switch {
+		case values[i] == nil && descending(key):
+			// nothing sorts after them.
+			continue
+		case values[i] == nil:
+			clause[key.Key] = bson.M{"$ne": nil}
+		case descending(key):
+			clause["$or"] = bson.A{bson.M{key.Key: bson.M{"$lt": values[i]}}, bson.M{key.Key: nil}}
+		default:
+			clause[key.Key] = bson.M{"$gt": values[i]}
+		}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+/* For inclusion projections, add the sort keys that are missing and return the top level ones that were added so
+ * they can be removed from the results again. */
+func projectionWithKeys(projection bson.M, sortKeys bson.D) (bson.M, []string) {
+	if len(projection) == 0 {
+		return nil, nil
+	}
+	inclusion := false
+	for field, value := range projection {
+		if field != "_id" && isTruthy(value) {
+			inclusion = true
+			break
+		}
+	}
+	if !inclusion {
+		return projection, nil
+	}
+
+	var added []string
+	result := bson.M{}
+	for field, value := range projection {
+		result[field] = value
+	}
+	for _, key := range sortKeys {
+		if value, ok := result[key.Key]; ok && isTruthy(value) {
+			continue
+		}
+		result[key.Key] = 1
+		if !strings.Contains(key.Key, ".") {
+			added = append(added, key.Key)
+		}
+	}
+	return result, added
+}
+
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case int32:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	// expressions such as $slice or $elemMatch select the field.
+	return value != nil
+}
+
+/* Look up a dotted path such as "a.b" in a decoded document. */
+func lookupPath(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case primitive.M:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case primitive.D:
+			found := false
+			for _, e := range node {
+				if e.Key == part {
+					current, found = e.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func encodePageToken(values bson.A) (string, error) {
+	raw, err := bson.Marshal(bson.M{"v": values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodePageToken(token string, keys int) (bson.A, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		V bson.A `bson:"v"`
+	}
+	if err := bson.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	if len(decoded.V) != keys {
+		return nil, errors.New("page token does not match the sort keys")
+	}
+	return decoded.V, nil
+}
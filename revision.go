@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// revisionField holds the revision counter of a document. The put and patch functions increment it on every write,
+// so a read-modify-write can tell that the document changed after it was read. It is removed from the maps
+// returned by the get functions. Documents written before it existed count as revision 0.
+const revisionField = "_rev"
+
+/* WriteOptions tunes the put, patch and delete functions. */
+type WriteOptions struct {
+	// Retries is the number of times a patch starts over from a fresh read when a concurrent write changed the
+	// document, 0 returns ErrWriteConflict right away.
+	Retries int
+	// IfMatch is the entity tag the document must have, as returned by RestfulAPIGetOneWithETag, or "*" for any
+	// existing document. The write fails with ErrPreconditionFailed otherwise, and puts never insert. Empty writes
+	// unconditionally.
+	IfMatch string
+}
+
+func writeOptions(opts []*WriteOptions) WriteOptions {
+	merged := WriteOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			merged = *opt
+		}
+	}
+	return merged
+}
+
+/* Build the update that sets data and bumps the revision. */
+func setUpdate(data interface{}) bson.M {
+	if doc, ok := data.(map[string]interface{}); ok {
+		if _, ok := doc[revisionField]; ok {
+			doc = copyMap(doc)
+			delete(doc, revisionField)
+		}
+		data = doc
+	}
+	return bson.M{"$set": data, "$inc": bson.M{revisionField: 1}}
+}
+
+func copyMap(doc map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		result[key] = value
+	}
+	return result
+}
+
+/* Remove the revision from a decoded document. */
+func stripRevision(doc interface{}) {
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		delete(d, revisionField)
+	case bson.M:
+		delete(d, revisionField)
+	case *map[string]interface{}:
+		delete(*d, revisionField)
+	case *bson.M:
+		delete(*d, revisionField)
+	}
+}
+
+/* Match the document with the given _id while it still has revision rev, nil standing for a missing revision. */
+func revisionFilter(id interface{}, rev interface{}) bson.M {
+	if rev == nil {
+		return bson.M{"_id": id, revisionField: bson.M{"$exists": false}}
+	}
+	return bson.M{"_id": id, revisionField: rev}
+}
+
+/* Read the document matching filter, let patch compute the update operators that modify it and run them only if
+ * the revision did not change in between. A concurrent write fails with ErrWriteConflict, or starts over from a
+ * fresh read up to opts.Retries times. patch gets the document without _id and revision, which it may modify, and
+ * the stored document as read. Next to the update it returns conditions, predicates the document must still match
+ * for the update to run; when they no longer hold the patch fails with ErrPreconditionFailed. An empty update skips
+ * the write. */
+func (db *DB) patchDocument(ctx context.Context, op string, collName string, filter bson.M, opts WriteOptions,
+	patch func(doc map[string]interface{}, raw bson.Raw) (update bson.M, conditions bson.M, err error)) error {
+	collection := db.collection(collName)
+	filter, err := db.readFilter(ctx, collName, filter)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	for attempt := 0; ; attempt++ {
+		err := db.patchOnce(ctx, op, collection, filter, opts, patch)
+		if !errors.Is(err, ErrWriteConflict) || attempt >= opts.Retries {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return wrapError(op, err)
+		}
+	}
+}
+
+func (db *DB) patchOnce(ctx context.Context, op string, collection *mongo.Collection, filter bson.M, opts WriteOptions,
+	patch func(doc map[string]interface{}, raw bson.Raw) (bson.M, bson.M, error)) error {
+	defer db.invalidateCache(collection.Name())
+	raw, err := collection.FindOne(ctx, filter).DecodeBytes()
+	if err != nil {
+		return wrapError(op, err)
+	}
+	var originalData bson.M
+	if err := bson.Unmarshal(raw, &originalData); err != nil {
+		return wrapError(op, err)
+	}
+	id, rev := originalData["_id"], originalData[revisionField]
+	if opts.IfMatch != "" {
+		expected, wildcard, ok := expectedRevision(opts.IfMatch)
+		if !ok || (!wildcard && expected != revisionNumber(rev)) {
+			return newError(op, ErrPreconditionFailed, nil)
+		}
+	}
+	delete(originalData, "_id")
+	delete(originalData, revisionField)
+
+	update, conditions, err := patch(normalize(originalData).(map[string]interface{}), raw)
+	if err != nil {
+		return err
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	update["$inc"] = bson.M{revisionField: 1}
+
+	updateFilter := revisionFilter(id, rev)
+	for field, value := range conditions {
+		updateFilter[field] = value
+	}
+	result, err := collection.UpdateOne(ctx, updateFilter, update)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	if len(conditions) > 0 {
+		conditions["_id"] = id
+		if n, err := collection.CountDocuments(ctx, conditions); err != nil {
+			return wrapError(op, err)
+		} else if n == 0 {
+			return newError(op, ErrPreconditionFailed, nil)
+		}
+	}
+	return newError(op, ErrWriteConflict, nil)
+}
@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deletedAtField marks a soft deleted document, a tombstone, with the time it was deleted.
+const deletedAtField = "deletedAt"
+
+// collectionMetadataCollection holds the settings of collections, such as soft delete, shared by all instances.
+const collectionMetadataCollection = "collectionMetadata"
+
+// softDeleteRecheck is how long an instance relies on a collection not using soft delete before it loads the
+// setting again.
+const softDeleteRecheck = time.Minute
+
+/* softDeleteState is the soft delete setting of a collection as last loaded. */
+type softDeleteState struct {
+	enabled bool
+	loaded  time.Time
+}
+
+/* SoftDeleteOptions configures soft delete for a collection. */
+type SoftDeleteOptions struct {
+	// Retention is how long tombstones are kept before a TTL index purges them, 0 keeps them until they are
+	// restored or purged with PurgeDeleted.
+	Retention time.Duration
+}
+
+/* Turn on soft delete for collName. The delete functions then mark documents with a deletedAt time instead of
+ * removing them, the get, patch and conditional put functions ignore such tombstones, and RestoreDeleted brings
+ * them back. A put on a tombstone replaces it, as if the document was inserted anew. The setting is stored in the
+ * database: the other instances load it on first use of the collection, or within a minute when they used it
+ * before. */
+func (db *DB) EnableSoftDelete(ctx context.Context, collName string, opts *SoftDeleteOptions) error {
+	const op = "EnableSoftDelete"
+	if err := db.check(op); err != nil {
+		return err
+	}
+	if opts != nil && opts.Retention > 0 {
+		if opts.Retention < time.Second {
+			return newError(op, nil, errors.New("retention must be at least one second"))
+		}
+		if err := db.ensureTTLIndex(ctx, op, collName, deletedAtField, opts.Retention); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.collection(collectionMetadataCollection).UpdateOne(ctx, bson.M{"_id": collName},
+		bson.M{"$set": bson.M{"softDelete": true}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return wrapError(op, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.softDelete[collName] = softDeleteState{enabled: true, loaded: time.Now()}
+	return nil
+}
+
+/* Report whether collName uses soft delete, loading the setting from the metadata collection on first use. */
+func (db *DB) softDeleted(ctx context.Context, collName string) (bool, error) {
+	db.mu.RLock()
+	state, ok := db.softDelete[collName]
+	db.mu.RUnlock()
+	if ok && (state.enabled || time.Since(state.loaded) < softDeleteRecheck) {
+		return state.enabled, nil
+	}
+
+	var stored struct {
+		SoftDelete bool `bson:"softDelete"`
+	}
+	err := db.collection(collectionMetadataCollection).FindOne(ctx, bson.M{"_id": collName}).Decode(&stored)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// EnableSoftDelete may have run in the meantime.
+	if state = db.softDelete[collName]; !state.enabled {
+		state = softDeleteState{enabled: stored.SoftDelete, loaded: time.Now()}
+		db.softDelete[collName] = state
+	}
+	return state.enabled, nil
+}
+
+/* Restrict filter to the documents of collName that are not tombstones. */
+func (db *DB) readFilter(ctx context.Context, collName string, filter bson.M) (bson.M, error) {
+	softDeleted, err := db.softDeleted(ctx, collName)
+	if err != nil || !softDeleted {
+		return filter, err
+	}
+	return liveFilter(filter), nil
+}
+
+/* Restrict filter to the documents that are not tombstones. */
+func liveFilter(filter bson.M) bson.M {
+	live := bson.M{deletedAtField: bson.M{"$exists": false}}
+	if len(filter) == 0 {
+		return live
+	}
+	return bson.M{"$and": bson.A{filter, live}}
+}
+
+/* Restrict filter to tombstones. */
+func deletedFilter(filter bson.M) bson.M {
+	deleted := bson.M{deletedAtField: bson.M{"$exists": true}}
+	if len(filter) == 0 {
+		return deleted
+	}
+	return bson.M{"$and": bson.A{filter, deleted}}
+}
+
+/* Build the update of a put of data on the document of collName matching filter. In soft delete collections it is
+ * a pipeline, which needs MongoDB 4.2, that replaces a tombstone by data instead of updating it, so that none of
+ * the deleted fields come back. The revived document keeps its _id and the fields filter matches by equality. The
+ * fields of data are merged at the top level, a dotted key names a field rather than a path. */
+func (db *DB) putUpdate(ctx context.Context, collName string, filter bson.M, data interface{}) (interface{},
+	error) {
+	update := setUpdate(data)
+	softDeleted, err := db.softDeleted(ctx, collName)
+	if err != nil || !softDeleted {
+		return update, err
+	}
+	revision := bson.M{revisionField: bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + revisionField, 0}}, 1}}}
+	set := bson.M{"$literal": update["$set"]}
+	live := bson.M{"$mergeObjects": bson.A{"$$ROOT", set, revision}}
+	revived := bson.M{"$mergeObjects": bson.A{
+		bson.M{"_id": "$_id"}, bson.M{"$literal": equalityFields(filter)}, set, revision,
+	}}
+	isLive := bson.M{"$eq": bson.A{bson.M{"$type": "$" + deletedAtField}, "missing"}}
+	return bson.A{bson.M{"$replaceWith": bson.M{"$cond": bson.A{isLive, live, revived}}}}, nil
+}
+
+/* Return the top level fields that filter matches by equality, which an upsert copies into the inserted document. */
+func equalityFields(filter bson.M) bson.M {
+	fields := bson.M{}
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") || strings.Contains(key, ".") || isOperatorDocument(value) {
+			continue
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+func isOperatorDocument(value interface{}) bool {
+	var doc map[string]interface{}
+	switch v := value.(type) {
+	case bson.M:
+		doc = v
+	case map[string]interface{}:
+		doc = v
+	default:
+		return false
+	}
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+/* Put data on the document of collName matching filter unless it exists: a tombstone is revived with data, while a
+ * live document is left as is. Report whether a live document existed. */
+func (db *DB) putIfAbsent(ctx context.Context, op string, collName string, filter bson.M,
+	data map[string]interface{}) (bool, error) {
+	collection := db.collection(collName)
+	softDeleted, err := db.softDeleted(ctx, collName)
+	if err != nil {
+		return false, wrapError(op, err)
+	}
+	if softDeleted {
+		defer db.invalidateCache(collName)
+		update, err := db.putUpdate(ctx, collName, filter, data)
+		if err != nil {
+			return false, wrapError(op, err)
+		}
+		result, err := collection.UpdateOne(ctx, deletedFilter(filter), update)
+		if err != nil {
+			return false, wrapError(op, err)
+		}
+		if result.MatchedCount > 0 {
+			return false, nil
+		}
+		filter = liveFilter(filter)
+	}
+	return db.putOne(ctx, op, collection, filter, bson.M{"$setOnInsert": data})
+}
+
+func tombstoneUpdate() bson.M {
+	return bson.M{"$set": bson.M{deletedAtField: time.Now()}, "$inc": bson.M{revisionField: 1}}
+}
+
+/* Delete one or all documents matching filter, honouring the soft delete setting of collName. */
+func (db *DB) deleteDocuments(ctx context.Context, collName string, filter bson.M, many bool) (int64, error) {
+	defer db.invalidateCache(collName)
+	collection := db.collection(collName)
+	softDeleted, err := db.softDeleted(ctx, collName)
+	if err != nil {
+		return 0, err
+	}
+	if softDeleted {
+		var result *mongo.UpdateResult
+		if many {
+			result, err = collection.UpdateMany(ctx, liveFilter(filter), tombstoneUpdate())
+		} else {
+			result, err = collection.UpdateOne(ctx, liveFilter(filter), tombstoneUpdate())
+		}
+		if err != nil {
+			return 0, err
+		}
+		return result.MatchedCount, nil
+	}
+
+	var result *mongo.DeleteResult
+	if many {
+		result, err = collection.DeleteMany(ctx, filter)
+	} else {
+		result, err = collection.DeleteOne(ctx, filter)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+/* Delete the document matching filter and decode it into result, honouring the soft delete setting of collName. */
+func (db *DB) findAndDeleteDocument(ctx context.Context, collName string, filter bson.M,
+	result interface{}) error {
+	defer db.invalidateCache(collName)
+	collection := db.collection(collName)
+	softDeleted, err := db.softDeleted(ctx, collName)
+	if err != nil {
+		return err
+	}
+	if softDeleted {
+		return collection.FindOneAndUpdate(ctx, liveFilter(filter), tombstoneUpdate(),
+			options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(result)
+	}
+	return collection.FindOneAndDelete(ctx, filter).Decode(result)
+}
+
+/* Bring back the tombstones of collName matching filter and return how many were restored. */
+func (db *DB) RestoreDeleted(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	const op = "RestoreDeleted"
+	if err := db.check(op); err != nil {
+		return 0, err
+	}
+	defer db.invalidateCache(collName)
+	result, err := db.collection(collName).UpdateMany(ctx, deletedFilter(filter),
+		bson.M{"$unset": bson.M{deletedAtField: ""}, "$inc": bson.M{revisionField: 1}})
+	if err != nil {
+		return 0, wrapError(op, err)
+	}
+	return result.ModifiedCount, nil
+}
+
+/* Remove the tombstones of collName matching filter for good and return how many were removed. */
+func (db *DB) PurgeDeleted(ctx context.Context, collName string, filter bson.M) (int64, error) {
+	const op = "PurgeDeleted"
+	if err := db.check(op); err != nil {
+		return 0, err
+	}
+	defer db.invalidateCache(collName)
+	result, err := db.collection(collName).DeleteMany(ctx, deletedFilter(filter))
+	if err != nil {
+		return 0, wrapError(op, err)
+	}
+	return result.DeletedCount, nil
+}
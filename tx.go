@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/* TxOptions tunes WithTransaction. */
+type TxOptions struct {
+	// AllowStandalone runs fn without a transaction on a standalone server, which does not support them. The
+	// writes of fn are then not atomic. By default WithTransaction fails with ErrTransactionsUnsupported there.
+	AllowStandalone bool
+}
+
+/* Tx gives access to the RestfulAPI* and pool functions inside a transaction. Its methods are the context variants
+ * of the DB methods, bound to the transaction context. */
+type Tx struct {
+	db  *DB
+	ctx context.Context
+}
+
+/* Run fn inside a transaction and commit it when fn returns nil, or abort it when fn returns an error. The whole
+ * transaction is retried while the server labels its errors TransientTransactionError, and the commit alone while
+ * they are labelled UnknownTransactionCommitResult, so fn may run more than once and must not have other side
+ * effects. Transactions need a replica set or a sharded cluster, see TxOptions for standalone servers. */
+func (db *DB) WithTransaction(ctx context.Context, fn func(tx *Tx) error, opts ...*TxOptions) error {
+	const op = "WithTransaction"
+	if err := db.check(op); err != nil {
+		return err
+	}
+
+	standalone, err := db.standalone(ctx)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	if standalone {
+		allow := false
+		for _, opt := range opts {
+			if opt != nil {
+				allow = opt.AllowStandalone
+			}
+		}
+		if !allow {
+			return newError(op, ErrTransactionsUnsupported, nil)
+		}
+		return fn(&Tx{db: db, ctx: ctx})
+	}
+
+	session, err := db.Client.StartSession()
+	if err != nil {
+		return wrapError(op, err)
+	}
+	defer session.EndSession(context.Background())
+
+	// the driver retries the transaction and its commit according to the error labels.
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&Tx{db: db, ctx: sc})
+	})
+	return wrapError(op, err)
+}
+
+/* Report whether the server is a standalone server. The answer is cached once known. */
+func (db *DB) standalone(ctx context.Context) (bool, error) {
+	db.mu.RLock()
+	known, standalone := db.topologyKnown, db.isStandalone
+	db.mu.RUnlock()
+	if known {
+		return standalone, nil
+	}
+
+	var reply struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := db.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&reply)
+	if err != nil {
+		return false, err
+	}
+	// replica set members report their set name, mongos routers answer isdbgrid.
+	standalone = reply.SetName == "" && reply.Msg != "isdbgrid"
+
+	db.mu.Lock()
+	db.topologyKnown, db.isStandalone = true, standalone
+	db.mu.Unlock()
+	return standalone, nil
+}
+
+/* Return the transaction context, for functions that Tx does not wrap such as Iterate or Collection methods. */
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+func (tx *Tx) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	return tx.db.RestfulAPIGetOneWithContext(tx.ctx, collName, filter)
+}
+
+func (tx *Tx) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	return tx.db.RestfulAPIGetManyWithContext(tx.ctx, collName, filter)
+}
+
+func (tx *Tx) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{},
+	opts ...*WriteOptions) (bool, error) {
+	return tx.db.RestfulAPIPutOneWithContext(tx.ctx, collName, filter, putData, opts...)
+}
+
+func (tx *Tx) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool,
+	error) {
+	return tx.db.RestfulAPIPutOneNotUpdateWithContext(tx.ctx, collName, filter, putData)
+}
+
+func (tx *Tx) RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{},
+	opts ...*BulkOptions) (*BulkResult, error) {
+	return tx.db.RestfulAPIPutManyWithContext(tx.ctx, collName, filterArray, putDataArray, opts...)
+}
+
+func (tx *Tx) PutOneCustomDataStructure(collName string, filter bson.M, putData interface{}) (bool, error) {
+	return tx.db.PutOneCustomDataStructureWithContext(tx.ctx, collName, filter, putData)
+}
+
+func (tx *Tx) RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	return tx.db.RestfulAPIPostWithContext(tx.ctx, collName, filter, postData)
+}
+
+func (tx *Tx) RestfulAPIPostMany(collName string, filter bson.M, postDataArray []interface{},
+	opts ...*BulkOptions) (*BulkResult, error) {
+	return tx.db.RestfulAPIPostManyWithContext(tx.ctx, collName, filter, postDataArray, opts...)
+}
+
+func (tx *Tx) RestfulAPIDeleteOne(collName string, filter bson.M, opts ...*WriteOptions) (int64, error) {
+	return tx.db.RestfulAPIDeleteOneWithContext(tx.ctx, collName, filter, opts...)
+}
+
+func (tx *Tx) RestfulAPIDeleteMany(collName string, filter bson.M) (int64, error) {
+	return tx.db.RestfulAPIDeleteManyWithContext(tx.ctx, collName, filter)
+}
+
+func (tx *Tx) RestfulAPIFindOneAndDelete(collName string, filter bson.M,
+	opts ...*WriteOptions) (map[string]interface{}, error) {
+	return tx.db.RestfulAPIFindOneAndDelete(tx.ctx, collName, filter, opts...)
+}
+
+func (tx *Tx) RestfulAPIMergePatch(collName string, filter bson.M, patchData map[string]interface{},
+	opts ...*WriteOptions) error {
+	return tx.db.RestfulAPIMergePatchWithContext(tx.ctx, collName, filter, patchData, opts...)
+}
+
+func (tx *Tx) RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte, opts ...*WriteOptions) error {
+	return tx.db.RestfulAPIJSONPatchWithContext(tx.ctx, collName, filter, patchJSON, opts...)
+}
+
+func (tx *Tx) RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string,
+	opts ...*WriteOptions) error {
+	return tx.db.RestfulAPIJSONPatchExtendWithContext(tx.ctx, collName, filter, patchJSON, dataName, opts...)
+}
+
+func (tx *Tx) GetUniqueIdentity() (int32, error) {
+	return tx.db.GetUniqueIdentityWithContext(tx.ctx)
+}
+
+func (tx *Tx) GetUniqueIdentityWithinRange(min int32, max int32) (int32, error) {
+	return tx.db.GetUniqueIdentityWithinRangeWithContext(tx.ctx, min, max)
+}
+
+func (tx *Tx) GetChunkFromPool(poolName string) (int32, int32, int32, error) {
+	return tx.db.GetChunkFromPoolWithContext(tx.ctx, poolName)
+}
+
+func (tx *Tx) ReleaseChunkToPool(poolName string, id int32) error {
+	return tx.db.ReleaseChunkToPoolWithContext(tx.ctx, poolName, id)
+}
+
+func (tx *Tx) GetIDFromInsertPool(poolName string) (int32, error) {
+	return tx.db.GetIDFromInsertPoolWithContext(tx.ctx, poolName)
+}
+
+func (tx *Tx) ReleaseIDToInsertPool(poolName string, id int32) error {
+	return tx.db.ReleaseIDToInsertPoolWithContext(tx.ctx, poolName, id)
+}
+
+func (tx *Tx) GetIDFromPool(poolName string) (int32, error) {
+	return tx.db.GetIDFromPoolWithContext(tx.ctx, poolName)
+}
+
+func (tx *Tx) ReleaseIDToPool(poolName string, id int32) error {
+	return tx.db.ReleaseIDToPoolWithContext(tx.ctx, poolName, id)
+}
@@ -0,0 +1,460 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package MongoDBLibrary
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/free5gc/MongoDBLibrary/logger"
+)
+
+// resumeTokenCollection stores the resume token of every named subscription.
+const resumeTokenCollection = "resumeTokens"
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	// maxDecodeAttempts is how often an event that cannot be decoded is read again before it is skipped.
+	maxDecodeAttempts = 3
+)
+
+// Server error codes after which reopening the change stream cannot succeed.
+var fatalChangeStreamCodes = []int{
+	260,   // InvalidResumeToken
+	280,   // ChangeStreamFatalError
+	286,   // ChangeStreamHistoryLost
+	40573, // change streams need a replica set
+}
+
+// errStreamInvalidated ends a subscription whose stream was closed by the server, for example because the
+// collection was dropped or renamed.
+var errStreamInvalidated = errors.New("change stream was invalidated")
+
+type ChangeType string
+
+const (
+	ChangeInsert  ChangeType = "insert"
+	ChangeUpdate  ChangeType = "update"
+	ChangeReplace ChangeType = "replace"
+	ChangeDelete  ChangeType = "delete"
+)
+
+/* ChangeEvent describes one change of a watched collection. */
+type ChangeEvent struct {
+	Type       ChangeType
+	Collection string
+	// DocumentKey holds the _id of the changed document, and the shard key on sharded collections.
+	DocumentKey bson.M
+	// Document is the document after the change for inserts and replaces, and for updates when
+	// WatchOptions.FullDocument is set or the watch has a filter. It is nil for deletes.
+	Document map[string]interface{}
+	// UpdatedFields and RemovedFields describe an update, with dotted paths as keys.
+	UpdatedFields map[string]interface{}
+	RemovedFields []string
+	ClusterTime   primitive.Timestamp
+}
+
+/* WatchOptions tunes Watch. */
+type WatchOptions struct {
+	// Name identifies the subscription. When set, the resume token up to which events were handled is stored under
+	// this name, and a later Watch with the same name continues from there, also from another process. Use one
+	// name per subscriber, not per collection.
+	Name string
+	// FullDocument looks up the current document for update events.
+	FullDocument bool
+	// MinBackoff and MaxBackoff bound the exponential delay between reconnection attempts after errors, they
+	// default to 100ms and 30s. The delay starts over from MinBackoff once a reopened stream delivered an event.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+/* Watcher is a running subscription, see Watch. */
+type Watcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+/* Call handler for every insert, update, replace and delete in collName, in the order of the changes, until ctx is
+ * done, Stop is called, handler returns an error or an error occurs that reconnecting cannot fix. Network errors
+ * and other transient failures reopen the change stream after a backoff, without losing or repeating events.
+ *
+ * filter selects documents like a find filter; updates are matched against the document after the update, and
+ * deletes are always delivered because the deleted document is no longer known. A nil filter watches everything.
+ * Events are delivered at least once: when handler fails or the process stops before the resume token of an event
+ * is stored, a named subscription sees that event again. An event that still cannot be decoded after three reads is
+ * logged and skipped. Change streams need a replica set or a sharded cluster. */
+func (db *DB) Watch(ctx context.Context, collName string, filter bson.M, handler func(event ChangeEvent) error,
+	opts *WatchOptions) (*Watcher, error) {
+	const op = "Watch"
+	if err := db.check(op); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	s := &subscription{
+		db:       db,
+		op:       op,
+		collName: collName,
+		pipeline: watchPipeline(filter),
+		handler:  handler,
+		opts:     *opts,
+	}
+	if s.opts.MinBackoff <= 0 {
+		s.opts.MinBackoff = defaultMinBackoff
+	}
+	if s.opts.MaxBackoff < s.opts.MinBackoff {
+		s.opts.MaxBackoff = defaultMaxBackoff
+	}
+	if len(filter) > 0 {
+		s.opts.FullDocument = true
+	}
+
+	token, err := s.loadToken(ctx)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	s.token = token
+	if s.token == nil {
+		// until the stream returns a resume token, reopening it starts over from the time of the first open.
+		if s.startAt, err = s.clusterTime(ctx); err != nil {
+			return nil, wrapError(op, err)
+		}
+	}
+	// the first stream is opened here so that setup errors reach the caller.
+	stream, err := s.open(ctx)
+	if err != nil {
+		return nil, wrapError(op, err)
+	}
+	if err := s.advance(ctx, stream); err != nil {
+		stream.Close(context.Background())
+		return nil, wrapError(op, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		err := s.run(ctx, stream)
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+	}()
+	return w, nil
+}
+
+/* Stop the subscription and wait until the handler has returned. It returns the error that ended the
+ * subscription, or nil when it was stopped. */
+func (w *Watcher) Stop() error {
+	w.cancel()
+	<-w.done
+	return w.Err()
+}
+
+/* Done is closed once the subscription has ended. */
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+/* Return the error that ended the subscription, nil while it runs or when it was stopped. */
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+type subscription struct {
+	db       *DB
+	op       string
+	collName string
+	pipeline mongo.Pipeline
+	handler  func(event ChangeEvent) error
+	opts     WatchOptions
+	token    bson.Raw
+	// startAt is the cluster time the stream is opened at while there is no resume token.
+	startAt *primitive.Timestamp
+	// decodeFailures counts the failed attempts to decode the event after token.
+	decodeFailures int
+}
+
+/* Build the change stream pipeline for filter. */
+func watchPipeline(filter bson.M) mongo.Pipeline {
+	types := bson.A{string(ChangeInsert), string(ChangeUpdate), string(ChangeReplace), string(ChangeDelete)}
+	match := bson.M{"operationType": bson.M{"$in": types}}
+	if len(filter) > 0 {
+		match = bson.M{"$and": bson.A{match, bson.M{"$or": bson.A{
+			bson.M{"operationType": string(ChangeDelete)},
+			prefixFilter(filter, "fullDocument."),
+		}}}}
+	}
+	return mongo.Pipeline{{{Key: "$match", Value: match}}}
+}
+
+/* Prefix the field names of a find filter, descending into $and, $or and $nor. */
+func prefixFilter(filter bson.M, prefix string) bson.M {
+	result := bson.M{}
+	for key, value := range filter {
+		if !strings.HasPrefix(key, "$") {
+			result[prefix+key] = value
+			continue
+		}
+		var clauses []interface{}
+		switch v := value.(type) {
+		case bson.A:
+			clauses = v
+		case []interface{}:
+			clauses = v
+		case []bson.M:
+			for _, clause := range v {
+				clauses = append(clauses, clause)
+			}
+		}
+		prefixed := bson.A{}
+		for _, clause := range clauses {
+			if m, ok := clause.(bson.M); ok {
+				clause = prefixFilter(m, prefix)
+			} else if m, ok := clause.(map[string]interface{}); ok {
+				clause = prefixFilter(m, prefix)
+			}
+			prefixed = append(prefixed, clause)
+		}
+		if clauses == nil {
+			// operators such as $expr or $where are passed on unchanged.
+			result[key] = value
+			continue
+		}
+		result[key] = prefixed
+	}
+	return result
+}
+
+func (s *subscription) open(ctx context.Context) (*mongo.ChangeStream, error) {
+	streamOpt := options.ChangeStream()
+	if s.opts.FullDocument {
+		streamOpt.SetFullDocument(options.UpdateLookup)
+	}
+	if s.token != nil {
+		streamOpt.SetResumeAfter(s.token)
+	} else if s.startAt != nil {
+		streamOpt.SetStartAtOperationTime(s.startAt)
+	}
+	return s.db.collection(s.collName).Watch(ctx, s.pipeline, streamOpt)
+}
+
+/* Return the current cluster time, nil when the server does not report one. */
+func (s *subscription) clusterTime(ctx context.Context) (*primitive.Timestamp, error) {
+	session, err := s.db.Client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(context.Background())
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		return s.db.Client.Database(s.db.Name).RunCommand(sc, bson.D{{Key: "ping", Value: 1}}).Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	value, err := session.ClusterTime().LookupErr("$clusterTime", "clusterTime")
+	if err != nil {
+		return nil, nil
+	}
+	t, i, ok := value.TimestampOK()
+	if !ok {
+		return nil, nil
+	}
+	return &primitive.Timestamp{T: t, I: i}, nil
+}
+
+/* Deliver events until the subscription ends, reopening the stream after transient errors. */
+func (s *subscription) run(ctx context.Context, stream *mongo.ChangeStream) error {
+	backoff := s.opts.MinBackoff
+	for {
+		if stream != nil {
+			delivered, err := s.deliver(ctx, stream)
+			stream.Close(context.Background())
+			if err == nil || ctx.Err() != nil {
+				return nil
+			}
+			var handlerErr *handlerError
+			if errors.As(err, &handlerErr) {
+				return handlerErr.err
+			}
+			if fatalChangeStreamError(err) {
+				return wrapError(s.op, err)
+			}
+			logger.MongoDBLog.Warnln("change stream on", s.collName, "failed, reconnecting:", err)
+			// only a stream that delivered events counts as recovered, one failing right away keeps backing off.
+			if delivered {
+				backoff = s.opts.MinBackoff
+			}
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+
+		var err error
+		if stream, err = s.open(ctx); err == nil {
+			if err = s.advance(ctx, stream); err != nil {
+				stream.Close(context.Background())
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if fatalChangeStreamError(err) {
+				return wrapError(s.op, err)
+			}
+			logger.MongoDBLog.Warnln("reopening change stream on", s.collName, "failed:", err)
+			stream = nil
+		}
+	}
+}
+
+/* handlerError carries an error returned by the handler, which ends the subscription. */
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+/* Read events from stream and hand them to the handler, reporting whether any was handled. It returns nil when ctx
+ * is done. */
+func (s *subscription) deliver(ctx context.Context, stream *mongo.ChangeStream) (bool, error) {
+	delivered := false
+	for {
+		if !stream.TryNext(ctx) {
+			if ctx.Err() != nil {
+				return delivered, nil
+			}
+			if err := stream.Err(); err != nil {
+				return delivered, err
+			}
+			if stream.ID() == 0 {
+				// the stream ends without error when it is invalidated.
+				return delivered, errStreamInvalidated
+			}
+		} else if event, err := decodeChangeEvent(stream.Current); err != nil {
+			if s.decodeFailures++; s.decodeFailures < maxDecodeAttempts {
+				return delivered, err
+			}
+			// resuming before an event that cannot be decoded would fail the same way forever.
+			logger.MongoDBLog.Errorln("skipping a change event on", s.collName, "that cannot be decoded:", err)
+			s.decodeFailures = 0
+		} else if err := s.handler(event); err != nil {
+			return delivered, &handlerError{err: err}
+		} else {
+			delivered = true
+			s.decodeFailures = 0
+		}
+		if err := s.advance(ctx, stream); err != nil {
+			return delivered, err
+		}
+	}
+}
+
+/* Take over the resume token of stream, which after an empty batch is the point the server has scanned up to, so
+ * that a reopened stream neither misses nor repeats events. A named subscription stores it when it changed. */
+func (s *subscription) advance(ctx context.Context, stream *mongo.ChangeStream) error {
+	token := stream.ResumeToken()
+	if token == nil || bytes.Equal(token, s.token) {
+		return nil
+	}
+	s.token = token
+	return s.saveToken(ctx)
+}
+
+func decodeChangeEvent(raw bson.Raw) (ChangeEvent, error) {
+	var doc struct {
+		OperationType string              `bson:"operationType"`
+		ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+		Ns            struct {
+			Coll string `bson:"coll"`
+		} `bson:"ns"`
+		DocumentKey       bson.M                 `bson:"documentKey"`
+		FullDocument      map[string]interface{} `bson:"fullDocument"`
+		UpdateDescription struct {
+			UpdatedFields map[string]interface{} `bson:"updatedFields"`
+			RemovedFields []string               `bson:"removedFields"`
+		} `bson:"updateDescription"`
+	}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return ChangeEvent{}, err
+	}
+	stripRevision(doc.FullDocument)
+	stripRevision(doc.UpdateDescription.UpdatedFields)
+	return ChangeEvent{
+		Type:          ChangeType(doc.OperationType),
+		Collection:    doc.Ns.Coll,
+		DocumentKey:   doc.DocumentKey,
+		Document:      doc.FullDocument,
+		UpdatedFields: doc.UpdateDescription.UpdatedFields,
+		RemovedFields: doc.UpdateDescription.RemovedFields,
+		ClusterTime:   doc.ClusterTime,
+	}, nil
+}
+
+func fatalChangeStreamError(err error) bool {
+	if errors.Is(err, errStreamInvalidated) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		for _, code := range fatalChangeStreamCodes {
+			if serverErr.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *subscription) loadToken(ctx context.Context) (bson.Raw, error) {
+	if s.opts.Name == "" {
+		return nil, nil
+	}
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.db.collection(resumeTokenCollection).FindOne(ctx, bson.M{"_id": s.opts.Name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return doc.Token, err
+}
+
+func (s *subscription) saveToken(ctx context.Context) error {
+	if s.opts.Name == "" {
+		return nil
+	}
+	_, err := s.db.collection(resumeTokenCollection).UpdateOne(ctx, bson.M{"_id": s.opts.Name},
+		bson.M{"$set": bson.M{"token": s.token, "collection": s.collName, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true))
+	return err
+}